@@ -0,0 +1,233 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MinAlignTokens is the least number of tokens a pattern must have for the longer
+// patterns to be aligned with it by AlignPatterns. A pattern is also only aligned
+// with the patterns that are at most twice as long.
+var MinAlignTokens = 3
+
+// alignGroup is the patterns that are merged into the shortest of them, the base.
+type alignGroup struct {
+	base Sequence
+
+	// gaps are the most tokens the members have in addition to the base, before
+	// each token of the base, and at the end
+	gaps []int
+}
+
+// AlignPatterns merges the patterns, e.g., as found by an analyzer, that only
+// differ by the tokens some of them have in addition to the others, so messages
+// of different lengths don't each have their own pattern. It returns the pattern
+// each of the patterns is merged into, in the same order, which is the pattern
+// itself if it's not merged with any other. The Analyzer does the same for the
+// patterns it finds if AnalyzerOptions.Align is set.
+//
+// The patterns can be the ones returned by an analyzer, or scanned from text,
+// where each %tag% is a literal. A pattern is merged with the longest of the
+// shorter patterns whose tokens are all in the pattern, in the same order. The
+// tokens that only some of the merged patterns have become
+//
+//   - %string?% or %string{0,n}%, for up to n tokens in between the others
+//   - %string-%, for any number of tokens at the end, if the shortest pattern
+//     ends with %string%, which then absorbs the rest of the message
+//   - %string{0,}%, for any number of tokens at the end, otherwise
+//
+// For example, the patterns
+//
+//   session closed for user %string%
+//   session closed for user %string% by %string%
+//
+// are merged into
+//
+//   session closed for user %string-%
+func AlignPatterns(pats []Sequence) []Sequence {
+	groups, member := alignGroups(alignTokens(pats))
+	merged := make([]Sequence, len(groups))
+
+	for g, group := range groups {
+		merged[g] = group.apply(group.base, group.base)
+	}
+
+	res := make([]Sequence, len(pats))
+
+	for i := range pats {
+		res[i] = merged[member[i]]
+	}
+
+	return res
+}
+
+// alignGroups returns the groups the patterns are merged into, and the group of
+// each of the patterns. The tokens of the patterns must be the fields or token
+// types, as returned by alignTokens.
+func alignGroups(pats []Sequence) ([]*alignGroup, []int) {
+	var (
+		order  = make([]int, len(pats))
+		groups []*alignGroup
+		member = make([]int, len(pats))
+	)
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(pats[order[i]]) < len(pats[order[j]])
+	})
+
+	for _, i := range order {
+		pat := pats[i]
+		best := -1
+
+		for g, group := range groups {
+			if len(group.base) < MinAlignTokens || len(group.base)*2 < len(pat) {
+				continue
+			}
+
+			if (best < 0 || len(group.base) > len(groups[best].base)) && alignGaps(group.base, pat) != nil {
+				best = g
+			}
+		}
+
+		if best < 0 {
+			member[i] = len(groups)
+			groups = append(groups, &alignGroup{base: pat, gaps: make([]int, len(pat)+1)})
+			continue
+		}
+
+		member[i] = best
+
+		for k, n := range alignGaps(groups[best].base, pat) {
+			if n > groups[best].gaps[k] {
+				groups[best].gaps[k] = n
+			}
+		}
+	}
+
+	return groups, member
+}
+
+// apply returns the merged pattern of the group for one of its members, where pat
+// is the member, with the tokens as returned by alignTokens, and seq is the
+// sequence to take the tokens from, e.g., the analyzed message, which has a token
+// for each of the tokens of pat. The tokens seq has in addition to the base are
+// taken by the %string% tokens of the merged pattern, with their values joined.
+func (this *alignGroup) apply(pat, seq Sequence) Sequence {
+	var (
+		res  Sequence
+		gaps = alignGaps(this.base, pat)
+		j    = 0
+	)
+
+	for k := range this.base {
+		if n := this.gaps[k]; n > 0 {
+			token := optionalStrings(n)
+			token.Value = joinValues(seq[j : j+gaps[k]])
+			res = append(res, token)
+		}
+
+		j += gaps[k]
+		res = append(res, seq[j])
+		j++
+	}
+
+	if n := this.gaps[len(this.base)]; n > 0 {
+		last := res[len(res)-1]
+
+		if last.Type == TokenString && last.Field == FieldUnknown && last.Meta == "" {
+			res[len(res)-1].Meta = string(metaRest)
+			res[len(res)-1].Value = joinValues(seq[j-1:])
+		} else {
+			res = append(res, Token{Type: TokenString, Meta: "{0,}", Value: joinValues(seq[j:])})
+		}
+	}
+
+	return res
+}
+
+// alignTokens returns a copy of the patterns, with each %tag% turned into its field
+// or token type, as the parser does, so the tokens can be compared.
+func alignTokens(pats []Sequence) []Sequence {
+	res := make([]Sequence, len(pats))
+
+	for i, pat := range pats {
+		res[i] = make(Sequence, len(pat))
+
+		for j, token := range pat {
+			if pt, err := newPatternToken(token); err == nil {
+				token = pt.Token
+			}
+
+			res[i][j] = token
+		}
+	}
+
+	return res
+}
+
+// alignGaps returns the number of tokens in the pattern before each token of the
+// base, and after the last one, if the tokens of the base are all in the pattern,
+// in the same order, or nil otherwise. The tokens of the base are matched to the
+// first tokens of the pattern that are the same.
+func alignGaps(base, pat Sequence) []int {
+	gaps := make([]int, len(base)+1)
+	j := 0
+
+	for k, token := range base {
+		for j < len(pat) && !sameToken(token, pat[j]) {
+			gaps[k]++
+			j++
+		}
+
+		if j == len(pat) {
+			return nil
+		}
+
+		j++
+	}
+
+	gaps[len(base)] = len(pat) - j
+
+	return gaps
+}
+
+// sameToken returns true if both tokens are the same token of a pattern.
+func sameToken(t1, t2 Token) bool {
+	if t1.Type != t2.Type || t1.Field != t2.Field || t1.Meta != t2.Meta {
+		return false
+	}
+
+	return t1.Type != TokenLiteral || strings.EqualFold(t1.Value, t2.Value)
+}
+
+// optionalStrings returns a %string% token that matches up to n tokens, or none,
+// or any number of them if n is more than MaxRepeat.
+func optionalStrings(n int) Token {
+	switch {
+	case n == 1:
+		return Token{Type: TokenString, Meta: string(metaOptional)}
+	case n > MaxRepeat:
+		return Token{Type: TokenString, Meta: "{0,}"}
+	}
+
+	return Token{Type: TokenString, Meta: fmt.Sprintf("{0,%d}", n)}
+}
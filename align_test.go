@@ -0,0 +1,211 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignPatterns(t *testing.T) {
+	max := MaxRepeat
+	defer func() { MaxRepeat = max }()
+
+	for _, tc := range []struct {
+		pats, merged []string
+		repeat       int
+	}{
+		{
+			[]string{
+				"session closed for user %string% by %string%",
+				"session closed for user %string%",
+			},
+			[]string{
+				"session closed for user %string-%",
+				"session closed for user %string-%",
+			},
+			0,
+		},
+		{
+			[]string{
+				"connection from %srcipv4% closed",
+				"connection from %srcipv4% port %srcport% closed",
+				"connection from %srcipv4% on %string% closed",
+				"connection from %srcipv4% closed by peer",
+			},
+			[]string{
+				"connection from %srcipv4% %string{0,2}% closed %string{0,}%",
+				"connection from %srcipv4% %string{0,2}% closed %string{0,}%",
+				"connection from %srcipv4% %string{0,2}% closed %string{0,}%",
+				"connection from %srcipv4% %string{0,2}% closed %string{0,}%",
+			},
+			0,
+		},
+		{
+			// too short, or too different, to be aligned
+			[]string{
+				"%string% %string%",
+				"%string% %string% %string%",
+				"job %integer% started",
+				"job %integer% stopped",
+				"job %integer% started after a long wait for the queue",
+			},
+			[]string{
+				"%string% %string%",
+				"%string% %string% %string%",
+				"job %integer% started",
+				"job %integer% stopped",
+				"job %integer% started after a long wait for the queue",
+			},
+			0,
+		},
+		{
+			// gaps longer than MaxRepeat match any number of tokens
+			[]string{
+				"connection from %srcipv4% closed",
+				"connection from %srcipv4% port %srcport% closed",
+			},
+			[]string{
+				"connection from %srcipv4% %string{0,}% closed",
+				"connection from %srcipv4% %string{0,}% closed",
+			},
+			1,
+		},
+	} {
+		if MaxRepeat = max; tc.repeat > 0 {
+			MaxRepeat = tc.repeat
+		}
+
+		pats := make([]Sequence, len(tc.pats))
+
+		for i, pat := range tc.pats {
+			seq, err := DefaultScanner.Tokenize(pat, nil)
+			require.NoError(t, err)
+			pats[i] = seq
+		}
+
+		merged := AlignPatterns(pats)
+		require.Len(t, merged, len(pats))
+
+		for i := range merged {
+			require.Equal(t, tc.merged[i], merged[i].String(), tc.pats[i])
+
+			// the merged patterns load into a parser
+			seq, err := DefaultScanner.Tokenize(merged[i].String(), nil)
+			require.NoError(t, err)
+			require.NoError(t, NewParser().Add(seq))
+		}
+	}
+}
+
+func TestAlignPatternsParse(t *testing.T) {
+	msgs := []string{
+		"Jan 12 06:49:42 irc sshd[7034]: session closed for user bob",
+		"Jan 12 06:49:43 irc sshd[7035]: session closed for user alice",
+		"Jan 12 06:49:44 irc sshd[7036]: session closed for user bob by admin",
+		"Jan 12 06:49:45 irc sshd[7037]: session closed for user carol by root",
+	}
+
+	atree := NewAnalyzer()
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq))
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	pats := make([]Sequence, len(msgs))
+
+	for i, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		pats[i], err = atree.Analyze(seq)
+		require.NoError(t, err)
+	}
+
+	// without aligning, there's one pattern for each length
+	require.NotEqual(t, pats[0].String(), pats[2].String())
+
+	merged := AlignPatterns(pats)
+	parser := NewParser()
+
+	for i := range merged {
+		require.Equal(t, merged[0].String(), merged[i].String())
+
+		seq, err := DefaultScanner.Tokenize(merged[i].String(), nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq))
+	}
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		_, err = parser.Parse(seq)
+		require.NoError(t, err, msg)
+	}
+}
+
+func TestAnalyzerAlign(t *testing.T) {
+	msgs := []string{
+		"Jan 12 06:49:42 irc sshd[7034]: session closed for user bob",
+		"Jan 12 06:49:43 irc sshd[7035]: session closed for user alice",
+		"Jan 12 06:49:44 irc sshd[7036]: session closed for user bob by admin",
+		"Jan 12 06:49:45 irc sshd[7037]: session closed for user carol by root",
+	}
+
+	atree := NewAnalyzer(AnalyzerOptions{Align: true})
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq))
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	pats := make([]Sequence, len(msgs))
+
+	for i, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		pats[i], err = atree.Analyze(seq)
+		require.NoError(t, err)
+		require.Equal(t, pats[0].String(), pats[i].String(), msg)
+	}
+
+	require.Equal(t, "%msgtime% %apphost% %appname% [ %sessionid% ] : %object% closed for user %srcuser% %string{0,}%", pats[0].String())
+	require.Equal(t, "bob", pats[2][len(pats[2])-2].Value)
+	require.Equal(t, "by admin", pats[2][len(pats[2])-1].Value)
+
+	seq, err := DefaultScanner.Tokenize(pats[0].String(), nil)
+	require.NoError(t, err)
+
+	parser := NewParser()
+	require.NoError(t, parser.Add(seq))
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		_, err = parser.Parse(seq)
+		require.NoError(t, err, msg)
+	}
+}
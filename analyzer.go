@@ -16,12 +16,12 @@ package sequence
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode"
 
 	"github.com/surge/porter2"
-	"github.com/surge/xparse/etld"
 	"github.com/willf/bitset"
 )
 
@@ -72,9 +72,75 @@ type Analyzer struct {
 	litmaps   []map[string]int
 	nodeCount []int
 
+	// Each level starts with a slot for each field type, followed by a slot for
+	// each token type, followed by the literals. Since fields can be registered at
+	// runtime, the number of field types is fixed when the analyzer is created.
+	fieldsCount int
+	typesCount  int
+
+	opts AnalyzerOptions
+
+	// protected are the lowercased literals in opts.Protected
+	protected map[string]bool
+
+	// priors are the number of times each field follows a literal, with a token
+	// of the field's type, in the patterns the analyzer is seeded with
+	priors map[seedKey]map[FieldType]int
+
+	// alignMsgs are the distinct messages added, by alignKeys, that are kept
+	// until Finalize() if opts.Align is set, and aligned is the group the path of
+	// each of them through the tree is merged into, by pathKey
+	alignMsgs []Sequence
+	alignKeys map[string]bool
+	aligned   map[string]*alignGroup
+
 	mu sync.RWMutex
 }
 
+// AnalyzerOptions are the thresholds the Analyzer uses to decide if the literals in
+// the same position of the messages should be merged into a variable token. The
+// zero value merges any 2 literals that share a parent and a child.
+type AnalyzerOptions struct {
+	// MinValues is the least number of distinct literals that share a parent and
+	// a child for them to be merged. Values less than 2 are taken as 2.
+	MinValues int
+
+	// MinSupport is the least number of messages a literal must be seen in, in its
+	// position, for it to be merged with the others. Literals seen less often are
+	// kept as they are, so rare messages aren't generalized.
+	MinSupport int
+
+	// Protected are the literals that are never merged, in addition to the keys of
+	// key=value pairs, e.g., "failed" or "accepted". They are compared
+	// case-insensitively.
+	Protected []string
+
+	// MinRepeat is the least number of tokens of the same type in a row, e.g., a
+	// list of IP addresses, for them to be taken as a single token that repeats,
+	// e.g., %ipv4+%, so the messages with lists of different lengths have the same
+	// pattern. 0 disables it, and values less than 2 are taken as 2.
+	MinRepeat int
+
+	// RestBranches is the least number of distinct tokens that must follow a
+	// literal, each with only literals after it, for the rest of the messages
+	// after the literal to be taken as free-form text, and matched with %string-%,
+	// e.g., the reasons in "job failed: disk full". The messages that have
+	// variables after the literal keep their patterns. 0 disables it.
+	RestBranches int
+
+	// Align merges the patterns of the messages that only differ by the tokens
+	// some of them have in addition to the others, as AlignPatterns does, so the
+	// messages of different lengths don't each have their own pattern. The
+	// distinct messages added are kept until Finalize() is called.
+	Align bool
+}
+
+// seedKey is the literal before a token, and the type of the token.
+type seedKey struct {
+	prev  string
+	ttype TokenType
+}
+
 type analyzerNode struct {
 	Token
 
@@ -86,6 +152,21 @@ type analyzerNode struct {
 
 	leaf bool
 
+	// rest is true if the tokens after this node can be free-form text, and
+	// restKids are the children that start it
+	rest     bool
+	restKids *bitset.BitSet
+
+	// free is true if this node, and all the nodes after it, are literals
+	free bool
+
+	// seeded is true if the node is in one of the patterns the analyzer is seeded
+	// with
+	seeded bool
+
+	// count is the number of messages added with this node in their path
+	count int
+
 	parents  *bitset.BitSet
 	children *bitset.BitSet
 }
@@ -100,12 +181,29 @@ func (this *stackAnalyzerNode) String() string {
 	return fmt.Sprintf("level=%d, score=%d, token=%v, leaf=%t", this.level, this.score, this.node.Token, this.node.leaf)
 }
 
-func NewAnalyzer() *Analyzer {
+// NewAnalyzer returns an Analyzer that uses the options, if they are supplied, or
+// the zero AnalyzerOptions otherwise.
+func NewAnalyzer(opts ...AnalyzerOptions) *Analyzer {
 	tree := &Analyzer{
-		root: newAnalyzerNode(),
-		leaf: newAnalyzerNode(),
+		root:        newAnalyzerNode(),
+		leaf:        newAnalyzerNode(),
+		fieldsCount: fieldTypesCount(),
+		protected:   make(map[string]bool),
+		priors:      make(map[seedKey]map[FieldType]int),
+		alignKeys:   make(map[string]bool),
+		aligned:     make(map[string]*alignGroup),
+	}
+
+	if len(opts) > 0 {
+		tree.opts = opts[0]
 	}
 
+	for _, lit := range tree.opts.Protected {
+		tree.protected[strings.ToLower(lit)] = true
+	}
+
+	tree.typesCount = tree.fieldsCount + TokenTypesCount
+
 	tree.root.level = -1
 
 	return tree
@@ -130,33 +228,162 @@ func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 
-	path, err := this.analyzeMessage(seq)
+	seq, path, err := this.analyze(seq)
 	if err != nil {
 		return nil, err
 	}
 
-	var seq2 Sequence
+	if group, ok := this.aligned[pathKey(path)]; ok {
+		return group.apply(pathTokens(path), seq), nil
+	}
+
+	return seq, nil
+}
+
+// analyze returns the pattern of the message, before it's aligned, and the path
+// of the message through the tree.
+func (this *Analyzer) analyze(seq Sequence) (Sequence, []*analyzerNode, error) {
+	seq = this.repeats(seq)
+
+	path, err := this.analyzeMessage(seq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		seq2 Sequence
+		lits []int
+	)
 
 	for i, n := range path {
+		if n.seeded && n.Type == TokenLiteral {
+			lits = append(lits, i)
+		}
+
 		n.Token.Value, n.Token.isKey, n.Token.isValue = seq[i].Value, seq[i].isKey, seq[i].isValue
+
+		// the last node is %string-% if the rest of the message is free-form text
+		if i == len(path)-1 && len(path) < len(seq) {
+			n.Token.Value = joinValues(seq[i:])
+		}
+
 		seq2 = append(seq2, n.Token)
 	}
 
 	//glog.Debugf("%s", seq2.PrintTokens())
 
-	return analyzeSequence(seq2), nil
+	seq2 = analyzeSequence(seq2)
+
+	// the literals of the known patterns stay literals
+	for _, i := range lits {
+		seq2[i].Field, seq2[i].Type = FieldUnknown, TokenLiteral
+	}
+
+	return this.applyPriors(seq2), path, nil
 }
 
 // Add adds a single message sequence to the analysis tree. It will not determine
 // if the tokens share a common parent or child at this point. After all the sequences
-// are added, then Finalize() should be called.
+// are added, then Finalize() should be called. It returns an error if a %tag% in
+// the sequence isn't a valid pattern token, e.g., %string{1,100}%.
 //func (this *Analyzer) Add(s string) error {
 func (this *Analyzer) Add(seq Sequence) error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
+	var (
+		key  = seq.String()
+		orig = append(Sequence(nil), seq...)
+	)
+
+	if err := this.add(seq, false); err != nil {
+		return err
+	}
+
+	if this.opts.Align && !this.alignKeys[key] {
+		this.alignKeys[key] = true
+		this.alignMsgs = append(this.alignMsgs, orig)
+	}
+
+	return nil
+}
+
+// Seed adds a known pattern sequence, e.g., from a pattern file, to the analysis
+// tree, so the patterns of the messages added are consistent with the known ones.
+// Seeding should be done before Finalize() is called, and it means
+//
+//   - the literals of the known patterns are never merged into variables, or
+//     named as fields
+//   - the literals that share a parent and a child with a %string% token, or a
+//     field of the string type, in a known pattern are merged into it
+//   - a token that follows the same literal, and has the same type, as a field in
+//     the known patterns is named after the field, e.g., the %ipv4% that follows
+//     "from" is %srcipv4%, if that's what most of the known patterns call it
+//
+// The constrained tokens of the known patterns, e.g., %action:allow|deny%, are
+// taken as variables of their types, without the constraints.
+func (this *Analyzer) Seed(seq Sequence) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	toks := make(Sequence, len(seq))
+
+	for i, token := range seq {
+		pt, err := newPatternToken(token)
+		if err != nil {
+			return err
+		}
+
+		toks[i] = pt.Token
+
+		// a constrained token, e.g., %action:allow|deny% or %literal:tcp|udp%, is
+		// seeded as a variable of its type, without the constraint, and isn't used
+		// as a prior
+		if pt.cons != nil {
+			toks[i].Meta = toks[i].Meta[:strings.IndexByte(toks[i].Meta, ':')]
+
+			if toks[i].Type == TokenLiteral {
+				toks[i].Type, toks[i].Value = TokenString, ""
+			}
+
+			continue
+		}
+
+		if i > 0 && toks[i].Field != FieldUnknown && toks[i-1].Type == TokenLiteral {
+			key := seedKey{strings.ToLower(toks[i-1].Value), toks[i].Type}
+
+			if this.priors[key] == nil {
+				this.priors[key] = make(map[FieldType]int)
+			}
+
+			this.priors[key][toks[i].Field]++
+		}
+	}
+
+	return this.add(toks, true)
+}
+
+// add adds the sequence to the analysis tree, and marks its nodes as seeded if
+// it's a known pattern. It returns an error if a %tag% in the sequence isn't a
+// valid pattern token.
+func (this *Analyzer) add(seq Sequence, seeded bool) error {
 	seq = markSequenceKV(seq)
 
+	// a %tag% in the sequence, with or without the meta, e.g., %string+%, is taken
+	// as its field or token type
+	toks := make(Sequence, len(seq))
+
+	for i, token := range seq {
+		pt, err := newPatternToken(token)
+		if err != nil {
+			return err
+		}
+
+		toks[i] = pt.Token
+	}
+
+	seq = this.repeats(toks)
+
 	// Add enough levels to support the depth of the token list
 	if l := len(seq) - len(this.levels) + 1; l > 0 {
 		newlevels := make([][]*analyzerNode, l)
@@ -164,7 +391,7 @@ func (this *Analyzer) Add(seq Sequence) error {
 		newmaps := make([]map[string]int, l)
 
 		for i := 0; i < l; i++ {
-			newlevels[i] = make([]*analyzerNode, allTypesCount)
+			newlevels[i] = make([]*analyzerNode, this.typesCount)
 			newlevels[i][0] = this.leaf
 			newmaps[i] = make(map[string]int)
 		}
@@ -176,26 +403,16 @@ func (this *Analyzer) Add(seq Sequence) error {
 	parent := this.root
 
 	for i, token := range seq {
-		vl := len(token.Value)
-		//more, rest := false, false
-
-		if vl >= 2 && token.Value[0] == '%' && token.Value[vl-1] == '%' {
-			// switch token.Value[vl-2] {
-			// case metaMore:
-			// 	token.Value = token.Value[:vl-2] + "%"
-			// 	more = true
-			// case metaRest:
-			// 	token.Value = token.Value[:vl-2] + "%"
-			// 	rest = true
-			// }
-
-			if f := name2FieldType(token.Value); f != FieldUnknown {
-				token.Field = f
-				token.Type = f.TokenType()
-			} else if t := name2TokenType(token.Value); t != TokenUnknown {
-				token.Type = t
-				token.Field = FieldUnknown
-			}
+		// The fields of the known patterns are kept as priors, so their tokens are
+		// in the same nodes as the tokens of the messages with the same type
+		if seeded {
+			token.Field = FieldUnknown
+		}
+
+		// Fields registered after the analyzer is created don't have a slot, so
+		// they are treated as their token types
+		if int(token.Field) >= this.fieldsCount {
+			token.Field = FieldUnknown
 		}
 
 		var foundNode *analyzerNode
@@ -218,11 +435,11 @@ func (this *Analyzer) Add(seq Sequence) error {
 			// token could contain different values. In this case, we add it to the
 			// list of token types.
 
-			if foundNode = this.levels[i][FieldTypesCount+int(token.Type)]; foundNode == nil {
+			if foundNode = this.levels[i][this.fieldsCount+int(token.Type)]; foundNode == nil {
 				foundNode = newAnalyzerNode()
 				foundNode.Token = token
 				foundNode.level = i
-				foundNode.index = FieldTypesCount + int(token.Type)
+				foundNode.index = this.fieldsCount + int(token.Type)
 				this.levels[i][foundNode.index] = foundNode
 			}
 
@@ -252,6 +469,11 @@ func (this *Analyzer) Add(seq Sequence) error {
 			}
 		}
 
+		// A node is repeated if the token is repeated in any of the messages
+		if token.Meta != "" {
+			foundNode.Meta = token.Meta
+		}
+
 		// We use a bitset to track parent and child relationships. In this case,
 		// we set the parent bit for the index of the current node, and set the
 		// child bit for the index of the parent node.
@@ -260,6 +482,12 @@ func (this *Analyzer) Add(seq Sequence) error {
 			parent.children.Set(uint(foundNode.index))
 		}
 
+		foundNode.count++
+
+		if seeded {
+			foundNode.seeded = true
+		}
+
 		parent = foundNode
 	}
 
@@ -281,11 +509,78 @@ func (this *Analyzer) Finalize() error {
 	defer this.mu.Unlock()
 
 	//fmt.Printf("in finalize\n")
+	this.mergeSeeds()
+
 	if err := this.merge(); err != nil {
 		return err
 	}
 
-	return this.compact()
+	if err := this.compact(); err != nil {
+		return err
+	}
+
+	this.markRest()
+	this.align()
+
+	return nil
+}
+
+// align finds the groups of the distinct paths of the messages added through the
+// tree that are merged, if opts.Align is set.
+func (this *Analyzer) align() {
+	var (
+		keys []string
+		pats []Sequence
+	)
+
+	for _, seq := range this.alignMsgs {
+		_, path, err := this.analyze(seq)
+		if err != nil {
+			continue
+		}
+
+		if key := pathKey(path); this.aligned[key] == nil {
+			this.aligned[key] = &alignGroup{}
+			keys = append(keys, key)
+			pats = append(pats, pathTokens(path))
+		}
+	}
+
+	groups, member := alignGroups(pats)
+
+	for i, key := range keys {
+		this.aligned[key] = groups[member[i]]
+	}
+
+	this.alignMsgs, this.alignKeys = nil, nil
+}
+
+// pathKey returns a key that identifies the path of a message through the tree.
+func pathKey(path []*analyzerNode) string {
+	keys := make([]string, len(path))
+
+	for i, n := range path {
+		if n.parents == nil {
+			// the %string-% node for free-form text isn't in the tree
+			keys[i] = "-"
+		} else {
+			keys[i] = strconv.Itoa(n.index)
+		}
+	}
+
+	return strings.Join(keys, ",")
+}
+
+// pathTokens returns the tokens of the nodes in the path, as returned by
+// alignTokens.
+func pathTokens(path []*analyzerNode) Sequence {
+	seq := make(Sequence, len(path))
+
+	for i, n := range path {
+		seq[i] = n.Token
+	}
+
+	return alignTokens([]Sequence{seq})[0]
 }
 
 // merge merges trie[i][k] into trie[i][j] and updates all parents and children
@@ -294,8 +589,8 @@ func (this *Analyzer) merge() error {
 	// For every level of this tree ...
 	for i, level := range this.levels {
 		// And for every literal child of this level ...
-		// remember literal children starts after all the types, thus j := allTypesCount
-		for j := allTypesCount; j < len(level); j++ {
+		// remember literal children starts after all the types, thus j := this.typesCount
+		for j := this.typesCount; j < len(level); j++ {
 			cur := level[j]
 
 			// - If the node is nil, then most likely it's been merged, so let's move on.
@@ -303,9 +598,12 @@ func (this *Analyzer) merge() error {
 			//   be merged, so let's move on.
 			// - If the node is a single character literal, and it's not a character in
 			//   a-zA-Z, then it shouldn't be merged, so let's move on.
+			// - If the node is protected, or not seen often enough, by the options,
+			//   then it shouldn't be merged, so let's move on.
 			if cur == nil || cur.isKey ||
 				(cur.Type == TokenLiteral && len(cur.Value) == 1 &&
-					!((cur.Value[0] >= 'a' && cur.Value[0] <= 'z') || (cur.Value[0] >= 'A' && cur.Value[0] <= 'Z'))) {
+					!((cur.Value[0] >= 'a' && cur.Value[0] <= 'z') || (cur.Value[0] >= 'A' && cur.Value[0] <= 'Z'))) ||
+				!this.mergeable(cur) {
 				continue
 			}
 
@@ -319,90 +617,119 @@ func (this *Analyzer) merge() error {
 			// if the number of nodes share at least 1 parent and 1 child is only 1, then
 			// it means it's only the curernt node left. In other words, no other nodes share
 			// at least 1 parent and 1 child with the current node. If so, move on.
-			if mergeSet.Count() > 1 {
-				// Otherwise, we want to merge the nodes that are in the mergeSet
-
-				// parents is the new parent bitset after the merging of all relevant nodes
-				parents := cur.parents
-
-				// children is the new children bitset after merging all relevant nodes
-				children := cur.children
-
-				leaf := cur.leaf
+			//
+			// With the MinValues option, there must be at least that many nodes.
+			minValues := this.opts.MinValues
+			if minValues < 2 {
+				minValues = 2
+			}
 
-				// For every node aside from the current node, let's merge their info
-				// into the current node (cur)
+			if mergeSet.Count() >= uint(minValues) {
+				// Otherwise, we want to merge the nodes that are in the mergeSet
 				//
 				// Check to see if the kth bit is set, if so, then we merge the kth node
 				// into current node
-
 				for k, e := mergeSet.NextSet(uint(j) + 1); e; k, e = mergeSet.NextSet(uint(k) + 1) {
+					this.mergeNode(i, j, int(k))
+				}
 
-					// The parents of the final merged node is the combination of all
-					// parents from all the merge nodes
-					parents.InPlaceUnion(level[k].parents)
+				cur.Type = TokenString
+			}
+		}
+	}
 
-					// The children of the final merged node is the combination of all
-					// children from all the merge nodes
-					children.InPlaceUnion(level[k].children)
+	return nil
+}
 
-					if leaf || level[k].leaf {
-						leaf = true
-					}
+// mergeSeeds merges the literals that share at least 1 parent and 1 child with a
+// seeded %string% node into it. The fields of the seeded patterns are in the nodes
+// of their token types, so these include the fields of the string type.
+func (this *Analyzer) mergeSeeds() {
+	for i, level := range this.levels {
+		if cur := level[this.fieldsCount+int(TokenString)]; cur != nil && cur.seeded {
+			j := cur.index
 
-					// Once we merge the parent and children bitset, we need to make sure
-					// all the parents of the merged node no longer points to the merged
-					// node, so we go through each parent and clear the kth child bit
-					//
-					// Make sure we are not at the top level since there's no more levels
-					// above it
-					if i > 0 {
-						plen := int(level[k].parents.Len())
-
-						for l := 0; l < plen; l++ {
-							// For each of the set parent bit of the kth node, we clear
-							// the kth child bit in the parent's children bitset
-							//
-							// Also, we set the parent's jth child bit since the parent
-							// needs to point to the new merged node
-							if level[k].parents.Test(uint(l)) {
-								this.levels[i-1][l].children.Clear(uint(k))
-								this.levels[i-1][l].children.Set(uint(j))
-							}
-						}
-					}
+			for k := this.typesCount; k < len(level); k++ {
+				tmp := level[k]
 
-					// Same for all the children of the merged node. For each of the
-					// children, we clear the kth parent bit
-					//
-					// Make sure we are not at the bottom level since there's no more
-					// levels below
-					if i < len(this.levels)-1 {
-						for l := 0; l < int(level[k].children.Len()); l++ {
-							// For each of the set child bit of the kth node, we clear
-							// the kth parent bit in the child's parents bitset
-							//
-							// Also, we set the child's jth parent bit since the parent
-							// needs to point to the new merged node
-							if level[k].children.Test(uint(l)) {
-								this.levels[i+1][l].parents.Clear(uint(k))
-								this.levels[i+1][l].parents.Set(uint(j))
-							}
-						}
-					}
+				if tmp == nil || tmp.isKey || tmp.Type != TokenLiteral ||
+					(len(tmp.Value) == 1 && !unicode.IsLetter(rune(tmp.Value[0]))) ||
+					!this.mergeable(tmp) {
 
-					level[k] = nil
+					continue
 				}
 
-				cur.parents = parents
-				cur.children = children
-				cur.leaf = leaf
-				cur.Type = TokenString
+				if cur.parents.IntersectionCardinality(tmp.parents) > 0 &&
+					cur.children.IntersectionCardinality(tmp.children) > 0 {
+
+					this.mergeNode(i, j, k)
+				}
 			}
 		}
 	}
+}
 
-	return nil
+// mergeNode merges trie[i][k] into trie[i][j], so the parents and children of the
+// kth node become the parents and children of the jth node, and removes the kth
+// node.
+func (this *Analyzer) mergeNode(i, j, k int) {
+	level := this.levels[i]
+	cur := level[j]
+
+	// The parents of the final merged node is the combination of all parents from
+	// all the merge nodes
+	cur.parents.InPlaceUnion(level[k].parents)
+
+	// The children of the final merged node is the combination of all children
+	// from all the merge nodes
+	cur.children.InPlaceUnion(level[k].children)
+
+	if level[k].leaf {
+		cur.leaf = true
+	}
+
+	cur.count += level[k].count
+
+	// Once we merge the parent and children bitset, we need to make sure all the
+	// parents of the merged node no longer points to the merged node, so we go
+	// through each parent and clear the kth child bit
+	//
+	// Make sure we are not at the top level since there's no more levels above it
+	if i > 0 {
+		plen := int(level[k].parents.Len())
+
+		for l := 0; l < plen; l++ {
+			// For each of the set parent bit of the kth node, we clear the kth child
+			// bit in the parent's children bitset
+			//
+			// Also, we set the parent's jth child bit since the parent needs to point
+			// to the new merged node
+			if level[k].parents.Test(uint(l)) {
+				this.levels[i-1][l].children.Clear(uint(k))
+				this.levels[i-1][l].children.Set(uint(j))
+			}
+		}
+	}
+
+	// Same for all the children of the merged node. For each of the children, we
+	// clear the kth parent bit
+	//
+	// Make sure we are not at the bottom level since there's no more levels below
+	if i < len(this.levels)-1 {
+		for l := 0; l < int(level[k].children.Len()); l++ {
+			// For each of the set child bit of the kth node, we clear the kth parent
+			// bit in the child's parents bitset
+			//
+			// Also, we set the child's jth parent bit since the parent needs to
+			// point to the new merged node
+			if level[k].children.Test(uint(l)) {
+				this.levels[i+1][l].parents.Clear(uint(k))
+				this.levels[i+1][l].parents.Set(uint(j))
+			}
+		}
+	}
+
+	level[k] = nil
 }
 
 // getMergeSet finds the nodes that share at least 1 parent and 1 child with trie[i][j]
@@ -429,9 +756,11 @@ func (this *Analyzer) getMergeSet(i, j int, cur *analyzerNode) (*bitset.BitSet,
 		// - We only merge nodes that are literals or strings, anything else
 		//   is already a variable so move on
 		// - If node is a single character literal, then not merging, move on
+		// - If node is protected, or not seen often enough, then not merging, move on
 		if tmp == nil ||
 			(tmp.Type != TokenLiteral && tmp.Type != TokenString) ||
-			(tmp.Type == TokenLiteral && len(tmp.Value) == 1) {
+			(tmp.Type == TokenLiteral && len(tmp.Value) == 1) ||
+			!this.mergeable(tmp) {
 
 			continue
 		}
@@ -463,6 +792,157 @@ func (this *Analyzer) getMergeSet(i, j int, cur *analyzerNode) (*bitset.BitSet,
 	return mergeSet, nil
 }
 
+// mergeable returns false if the node is a protected literal, or it's seen in
+// fewer messages than the MinSupport option.
+func (this *Analyzer) mergeable(node *analyzerNode) bool {
+	if node.Type == TokenLiteral && (node.seeded || this.protected[strings.ToLower(node.Value)]) {
+		return false
+	}
+
+	return node.count >= this.opts.MinSupport
+}
+
+// repeats returns the sequence with each run of at least MinRepeat tokens of the
+// same type, other than literals and strings, replaced by a single token with the
+// %type+% meta, and the values of the run. The sequence itself isn't changed.
+func (this *Analyzer) repeats(seq Sequence) Sequence {
+	if this.opts.MinRepeat <= 0 {
+		return seq
+	}
+
+	minRepeat := this.opts.MinRepeat
+	if minRepeat < 2 {
+		minRepeat = 2
+	}
+
+	seq2 := make(Sequence, 0, len(seq))
+
+	for i := 0; i < len(seq); {
+		token := seq[i]
+		j := i + 1
+
+		if token.Type != TokenLiteral && token.Type != TokenString && token.Type != TokenUnknown && token.Meta == "" {
+			for j < len(seq) && seq[j].Type == token.Type && seq[j].Field == token.Field && seq[j].Meta == "" {
+				j++
+			}
+		}
+
+		if j-i < minRepeat {
+			seq2 = append(seq2, seq[i:j]...)
+		} else {
+			token.Value, token.Meta = joinValues(seq[i:j]), string(metaMore)
+			seq2 = append(seq2, token)
+		}
+
+		i = j
+	}
+
+	return seq2
+}
+
+// markRest marks the literals that are followed by at least RestBranches children
+// with only literals after them as the start of free-form text.
+func (this *Analyzer) markRest() {
+	if this.opts.RestBranches <= 0 || len(this.levels) == 0 {
+		return
+	}
+
+	// From the last level up, a node is free if it's a literal, and all of its
+	// children are free. The 0th child bit marks the end of a message, so it's
+	// not a child.
+	for i := len(this.levels) - 1; i >= 0; i-- {
+		for j, cur := range this.levels[i] {
+			if j == 0 || cur == nil {
+				continue
+			}
+
+			cur.free = cur.Type == TokenLiteral
+
+			for k, e := cur.children.NextSet(1); e && cur.free && i < len(this.levels)-1; k, e = cur.children.NextSet(k + 1) {
+				cur.free = this.levels[i+1][k].free
+			}
+		}
+	}
+
+	for i, level := range this.levels[:len(this.levels)-1] {
+		for j, cur := range level {
+			if j == 0 || cur == nil || cur.Type != TokenLiteral || cur.isKey {
+				continue
+			}
+
+			kids := bitset.New(1)
+
+			for k, e := cur.children.NextSet(1); e; k, e = cur.children.NextSet(k + 1) {
+				if this.levels[i+1][k].free {
+					kids.Set(k)
+				}
+			}
+
+			if kids.Count() >= uint(this.opts.RestBranches) {
+				cur.rest, cur.restKids = true, kids
+			}
+		}
+	}
+}
+
+// applyPriors names the tokens after the fields in the seeded patterns that follow
+// the same literal, and have the same type. If the known patterns don't agree,
+// the field that's used the most wins. A field that's already in the sequence
+// isn't used again.
+func (this *Analyzer) applyPriors(seq Sequence) Sequence {
+	if len(this.priors) == 0 {
+		return seq
+	}
+
+	for i := 1; i < len(seq); i++ {
+		if seq[i].Type == TokenLiteral || seq[i-1].Type != TokenLiteral {
+			continue
+		}
+
+		var (
+			best  = FieldUnknown
+			count int
+		)
+
+		for f, n := range this.priors[seedKey{strings.ToLower(seq[i-1].Value), seq[i].Type}] {
+			if n > count || (n == count && f < best) {
+				best, count = f, n
+			}
+		}
+
+		if best == FieldUnknown || best == seq[i].Field {
+			continue
+		}
+
+		used := false
+
+		for k, tok := range seq {
+			if k != i && tok.Field == best {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			seq[i].Field = best
+			seq[i].Type = best.TokenType()
+		}
+	}
+
+	return seq
+}
+
+// joinValues returns the values of the tokens, separated by spaces.
+func joinValues(seq Sequence) string {
+	values := make([]string, len(seq))
+
+	for i, token := range seq {
+		values[i] = token.Value
+	}
+
+	return strings.Join(values, " ")
+}
+
 func (this *Analyzer) compact() error {
 	// Build a complete new trie
 	newLevels := make([][]*analyzerNode, len(this.levels))
@@ -482,7 +962,7 @@ func (this *Analyzer) compact() error {
 	// Add any literals to the hash
 	for i, level := range this.levels {
 		for j, cur := range level {
-			if j < allTypesCount || cur != nil {
+			if j < this.typesCount || cur != nil {
 				newLevels[i] = append(newLevels[i], cur)
 
 				if cur != nil {
@@ -576,6 +1056,22 @@ func (this *Analyzer) analyzeMessage(seq Sequence) ([]*analyzerNode, error) {
 			path[cur.level] = cur.node
 		}
 
+		// If the current node can start free-form text, and there are tokens left,
+		// then the rest of the message is matched by a %string-% token, and scored
+		// as if each of the tokens is a partial match. The children that start
+		// free-form text aren't visited, so only the messages that match one of the
+		// other children keep their patterns.
+		if cur.node.rest && cur.level < len(seq) {
+			tmppath := append(make([]*analyzerNode, 0, cur.level+1), path[1:cur.level+1]...)
+			tmppath = append(tmppath, &analyzerNode{Token: Token{Type: TokenString, Meta: string(metaRest)}})
+			paths = append(paths, tmppath)
+
+			if score := cur.score + (len(seq)-cur.level)*partialMatchWeight; score > bestScore {
+				bestScore = score
+				bestPath = len(paths) - 1
+			}
+		}
+
 		// If the current level we are visiting is greater or equal to the number of
 		// tokens in the message, that means we have exhausted the message length. If
 		// the current node is also a leaf node, it means we have matched a pattern,
@@ -605,7 +1101,7 @@ func (this *Analyzer) analyzeMessage(seq Sequence) ([]*analyzerNode, error) {
 		for i, e := cur.node.children.NextSet(0); e; i, e = cur.node.children.NextSet(i + 1) {
 			node := this.levels[cur.node.level+1][i]
 
-			if node != nil {
+			if node != nil && !(cur.node.rest && cur.node.restKids.Test(i)) {
 				// Anything other than these 3 conditions are considered no match.
 				switch {
 				case node.Type == token.Type && token.Type != TokenLiteral && token.Type != TokenString:
@@ -616,11 +1112,11 @@ func (this *Analyzer) analyzeMessage(seq Sequence) ([]*analyzerNode, error) {
 					// This is also considered a full match since the types matched
 					toVisit = append(toVisit, stackAnalyzerNode{node, cur.level + 1, cur.score + fullMatchWeight})
 
-				case node.Type == TokenString && token.Type == TokenLiteral &&
-					(len(token.Value) != 1 || (len(token.Value) == 1 && unicode.IsLetter(rune(token.Value[0])))):
+				case node.Type == TokenString && (isLiteralShape(token.Type) || token.Type == TokenLiteral &&
+					(len(token.Value) != 1 || (len(token.Value) == 1 && unicode.IsLetter(rune(token.Value[0]))))):
 					// If the node is a string and token is a non-one-character literal,
-					// then it's considered a partial match, since a literal is
-					// technically a string.
+					// or a host name, email, etc, then it's considered a partial match,
+					// since these are technically strings.
 					toVisit = append(toVisit, stackAnalyzerNode{node, cur.level + 1, cur.score + partialMatchWeight})
 
 				case node.Type == TokenLiteral && token.Type == TokenLiteral && node.Value == token.Value:
@@ -718,15 +1214,11 @@ func markSequenceKV(seq Sequence) Sequence {
 
 func analyzeSequence(seq Sequence) Sequence {
 	l := len(seq)
-	var fexists [FieldTypesCount]bool
+	fexists := make([]bool, fieldTypesCount())
 
 	defer func() {
 		// Step 7: try to see if we can find any srcport and dstport fields
 		for i, tok := range seq {
-			if tok.Type == token__host__ || tok.Type == token__email__ {
-				seq[i].Type = TokenString
-			}
-
 			if i < l-2 && tok.Type == TokenIPv4 && (seq[i+1].Value == "/" || seq[i+1].Value == ":") &&
 				seq[i+2].Type == TokenInteger {
 
@@ -768,19 +1260,14 @@ func analyzeSequence(seq Sequence) Sequence {
 		}
 	}
 
-	// Step 2: lower case all literals, and try to recognize emails and host names
+	// Step 2: lower case all literals, and try to recognize the host names that the
+	// scanner leaves as literals, e.g., local4.info
 	for i, tok := range seq {
 		if tok.Type == TokenLiteral && tok.Field == FieldUnknown {
 			seq[i].Value = strings.ToLower(tok.Value)
 
-			// Matching a effective top level domain
-			if etld.Match(tok.Value) > 0 {
-				// Matching an email address
-				if strings.Index(tok.Value, "@") > 0 {
-					seq[i].Type = token__email__
-				} else if strings.Index(tok.Value, ".") > 0 {
-					seq[i].Type = token__host__
-				}
+			if isHost(tok.Value) {
+				seq[i].Type = TokenHost
 			}
 		}
 	}
@@ -796,7 +1283,7 @@ func analyzeSequence(seq Sequence) Sequence {
 	// - "Oct 11 22:14:15 mymachine su: ..."
 	// - "Aug 24 05:34:00 CST 1987 mymachine myproc[10]: ..."
 	if len(seq) >= 6 && seq[0].Type == TokenInteger && seq[1].Type == TokenTime &&
-		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == token__host__ || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
+		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == TokenHost || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		seq[3].Type == TokenLiteral &&
 		(seq[4].Type == TokenInteger || (seq[4].Type == TokenLiteral && seq[4].Value == "-")) &&
 		(seq[5].Type == TokenLiteral) {
@@ -812,7 +1299,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[2].Field = FieldAppIPv4
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[2].Field = FieldAppHost
 		}
 
@@ -834,7 +1321,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[5].Type = seq[5].Field.TokenType()
 		fexists[seq[5].Field] = true
 	} else if len(seq) >= 4 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == ":") {
 
@@ -849,7 +1336,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Field = FieldAppIPv4
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Field = FieldAppHost
 		}
 
@@ -861,7 +1348,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[2].Type = seq[2].Field.TokenType()
 		fexists[seq[2].Field] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == "[") &&
 		(seq[4].Type == TokenInteger) &&
@@ -879,7 +1366,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Field = FieldAppIPv4
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Field = FieldAppHost
 		}
 
@@ -896,7 +1383,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[4].Type = seq[4].Field.TokenType()
 		fexists[seq[4].Field] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		seq[2].Value == "last" {
 
 		// "jan 12 06:49:56 irc last message repeated 6 times"
@@ -910,7 +1397,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Field = FieldAppIPv4
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Field = FieldAppHost
 		}
 
@@ -950,7 +1437,7 @@ LOOP:
 				// This is a specific type, so match the type, within the next 2 tokens
 				// away, not counting single character non-a-zA-Z tokens.
 				for k := i + 1; k < l && j < distance; k++ {
-					if !fexists[f] && seq[k].Field == FieldUnknown && f.TokenType() == seq[k].Type && !seq[k].isKey {
+					if !fexists[f] && seq[k].Field == FieldUnknown && looseType(f.TokenType(), seq[k].Type) && !seq[k].isKey {
 						seq[k].Field = f
 						seq[k].Type = seq[k].Field.TokenType()
 						fexists[seq[k].Field] = true
@@ -986,8 +1473,8 @@ LOOP:
 				case FieldSrcHost, FieldDstHost, FieldSrcEmail, FieldDstEmail:
 					for k := i + 1; k < l && k < i+distance; k++ {
 						if !fexists[f] && seq[k].Field == FieldUnknown && !seq[k].isKey &&
-							(seq[k].Type == token__host__ && (f == FieldSrcHost || f == FieldDstHost)) ||
-							(seq[k].Type == token__email__ && (f == FieldSrcEmail || f == FieldDstEmail)) {
+							(seq[k].Type == TokenHost && (f == FieldSrcHost || f == FieldDstHost)) ||
+							(seq[k].Type == TokenEmail && (f == FieldSrcEmail || f == FieldDstEmail)) {
 
 							seq[k].Field = f
 							seq[k].Type = seq[k].Field.TokenType()
@@ -1092,7 +1579,7 @@ LOOP:
 					fexists[FieldDstIPv4] = true
 				}
 
-			case token__host__:
+			case TokenHost:
 				if !fexists[FieldSrcHost] {
 					seq[i].Field = FieldSrcHost
 					seq[i].Type = seq[i].Field.TokenType()
@@ -1103,7 +1590,7 @@ LOOP:
 					fexists[FieldDstHost] = true
 				}
 
-			case token__email__:
+			case TokenEmail:
 				if !fexists[FieldSrcEmail] {
 					seq[i].Field = FieldSrcEmail
 					seq[i].Type = seq[i].Field.TokenType()
@@ -56,7 +56,7 @@ var (
 		{
 			"id=firewall time=\"2005-03-18 14:01:46\" fw=TOPSEC priv=6 recorder=kernel type=conn policy=414 proto=TCP rule=accept src=61.167.71.244 sport=35223 dst=210.82.119.211 dport=25 duration=27 inpkt=37 outpkt=39 sent=1770 rcvd=20926 smac=00:04:c1:8b:d8:82 dmac=00:0b:5f:b2:1d:80",
 			//"id = %string% time = \" %time% \" fw = %string% priv = %integer% recorder = %string% type = %string% policy = %integer% proto = %string% rule = %string% src = %ipv4% sport = %integer% dst = %ipv4% dport = %integer% duration = %integer% inpkt = %integer% outpkt = %integer% sent = %integer% rcvd = %integer% smac = %mac% dmac = %mac%",
-			"id = %string% time = \" %msgtime% \" fw = %string% priv = %integer% recorder = %string% type = %string% policy = %integer% proto = %protocol% rule = %string% src = %srcipv4% sport = %srcport% dst = %dstipv4% dport = %dstport% duration = %integer% inpkt = %integer% outpkt = %integer% sent = %integer% rcvd = %integer% smac = %srcmac% dmac = %dstmac%",
+			"id = %string% time = \" %msgtime% \" fw = %string% priv = %integer% recorder = %string% type = %string% policy = %integer% proto = %protocol% rule = %string% src = %srcipv4% sport = %srcport% dst = %dstipv4% dport = %dstport% duration = %duration% inpkt = %integer% outpkt = %integer% sent = %integer% rcvd = %integer% smac = %srcmac% dmac = %dstmac%",
 		},
 		{
 			"id=firewall time=\"2005-03-18 14:01:43\" fw=TOPSEC priv=4 recorder=kernel type=conn policy=504 proto=TCP rule=deny src=210.82.121.91 sport=4958 dst=61.229.37.85 dport=23124 smac=00:0b:5f:b2:1d:80 dmac=00:04:c1:8b:d8:82",
@@ -92,10 +92,10 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l := 0
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
-		if i == FieldTypesCount+int(TokenTime) {
+		if i == atree.fieldsCount+int(TokenTime) {
 			require.NotNil(t, node, fmt.Sprintf("Expected: levels[%d][TokenTime] != nil, Actual: got nil", l))
 		} else {
 			require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -106,7 +106,7 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 1
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
 		require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -118,7 +118,7 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 2
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
 		require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -128,10 +128,10 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 4
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
-		if i == FieldTypesCount+int(TokenInteger) {
+		if i == atree.fieldsCount+int(TokenInteger) {
 			require.NotNil(t, node, fmt.Sprintf("Expected: levels[%d][TokenInteger] != nil, Actual: got nil", l))
 		} else {
 			require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -142,7 +142,7 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 7
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
 		require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -152,7 +152,7 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 8
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
 		require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -162,10 +162,10 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 12
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
-		if i == FieldTypesCount+int(TokenIPv4) {
+		if i == atree.fieldsCount+int(TokenIPv4) {
 			require.NotNil(t, node, fmt.Sprintf("Expected: levels[%d][TokenIPv4] != nil, Actual: got nil", l))
 		} else {
 			require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -176,10 +176,10 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 
 	l = 14
 
-	for i := 1; i < allTypesCount; i++ {
+	for i := 1; i < atree.typesCount; i++ {
 		node := atree.levels[l][i]
 
-		if i == FieldTypesCount+int(TokenInteger) {
+		if i == atree.fieldsCount+int(TokenInteger) {
 			require.NotNil(t, node, fmt.Sprintf("Expected: levels[%d][TokenInteger] != nil, Actual: got nil", l))
 		} else {
 			require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
@@ -191,15 +191,15 @@ func TestAnalyzerMergeNodes(t *testing.T) {
 	atree.Finalize()
 
 	for _, l := range []int{1, 7, 8, 10} {
-		require.Equal(t, allTypesCount+1, len(atree.levels[l]), fmt.Sprintf("Expected: len(levels[%d]) == %d, Actual: got non-nil %s", l, allTypesCount+1, len(atree.levels[l])))
+		require.Equal(t, atree.typesCount+1, len(atree.levels[l]), fmt.Sprintf("Expected: len(levels[%d]) == %d, Actual: got non-nil %d", l, atree.typesCount+1, len(atree.levels[l])))
 
-		for i := 1; i < allTypesCount; i++ {
+		for i := 1; i < atree.typesCount; i++ {
 			node := atree.levels[l][i]
 			require.Nil(t, node, fmt.Sprintf("Expected: levels[%d][%d] == nil, Actual: got non-nil %s", l, i, node))
 		}
 
-		node := atree.levels[l][allTypesCount]
-		require.Equal(t, TokenString, node.Type, fmt.Sprintf("Expected: levels[%d][%d].Type == TokenString, Actual: got %s", l, allTypesCount+1, node.Type))
+		node := atree.levels[l][atree.typesCount]
+		require.Equal(t, TokenString, node.Type, fmt.Sprintf("Expected: levels[%d][%d].Type == TokenString, Actual: got %s", l, atree.typesCount+1, node.Type))
 	}
 }
 
@@ -285,3 +285,223 @@ func TestAnalyzerMatchPatterns(t *testing.T) {
 		require.Equal(t, tc.pat, seq.String(), tc.msg, seq)
 	}
 }
+
+func TestAnalyzerOptions(t *testing.T) {
+	msgs := []string{
+		"worker job alpha started on node1",
+		"worker job beta started on node1",
+		"worker job gamma started on node1",
+		"worker job beta started on node1",
+		"worker job alpha started on node1",
+	}
+
+	for _, tc := range []struct {
+		opts AnalyzerOptions
+		pats []string
+	}{
+		{AnalyzerOptions{}, []string{"%string%", "%string%", "%string%", "%string%", "%string%"}},
+		{AnalyzerOptions{MinValues: 3}, []string{"%string%", "%string%", "%string%", "%string%", "%string%"}},
+		{AnalyzerOptions{MinValues: 4}, []string{"alpha", "beta", "gamma", "beta", "alpha"}},
+		{AnalyzerOptions{MinSupport: 2}, []string{"%string%", "%string%", "gamma", "%string%", "%string%"}},
+		{AnalyzerOptions{MinSupport: 3}, []string{"alpha", "beta", "gamma", "beta", "alpha"}},
+		{AnalyzerOptions{Protected: []string{"BETA"}}, []string{"%string%", "beta", "%string%", "beta", "%string%"}},
+	} {
+		atree := NewAnalyzer(tc.opts)
+
+		for _, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+			require.NoError(t, atree.Add(seq))
+		}
+
+		require.NoError(t, atree.Finalize())
+
+		for i, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+
+			seq, err = atree.Analyze(seq)
+			require.NoError(t, err, msg)
+			require.Equal(t, "worker job "+tc.pats[i]+" %action% on node1", seq.String(), fmt.Sprintf("%+v: %s", tc.opts, msg))
+		}
+	}
+}
+
+func TestAnalyzerRepeatRest(t *testing.T) {
+	msgs := []string{
+		"blocked hosts 10.0.0.1 from rule 7",
+		"blocked hosts 10.0.0.1 10.0.0.2 from rule 8",
+		"blocked hosts 10.0.0.1 10.0.0.2 10.0.0.3 from rule 9",
+		"job failed: disk full",
+		"job failed: connection reset by peer",
+		"job failed: timeout",
+		"job failed: no route to host",
+		"job failed: exit code 3",
+		"job failed: exit code 12",
+	}
+
+	pats := []string{
+		"%action% hosts %srcipv4+% from %object% %integer%",
+		"%action% hosts %srcipv4+% from %object% %integer%",
+		"%action% hosts %srcipv4+% from %object% %integer%",
+		"job %status% : %string-%",
+		"job %status% : %string-%",
+		"job %status% : %string-%",
+		"job %status% : %string-%",
+		"job %status% : exit code %integer%",
+		"job %status% : exit code %integer%",
+	}
+
+	atree := NewAnalyzer(AnalyzerOptions{MinRepeat: 2, RestBranches: 3})
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq))
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	parser := NewParser()
+
+	for i, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		aseq, err := atree.Analyze(seq)
+		require.NoError(t, err, msg)
+		require.Equal(t, pats[i], aseq.String(), msg)
+
+		seq, err = DefaultScanner.Tokenize(aseq.String(), nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq))
+	}
+
+	// the patterns match all the messages, and other lists and reasons
+	for _, msg := range append(msgs, "blocked hosts 10.0.0.4 10.0.0.5 10.0.0.6 10.0.0.7 from rule 10", "job failed: out of memory", "job failed: exit code 7") {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		_, err = parser.Parse(seq)
+		require.NoError(t, err, msg)
+	}
+
+	// without the options, each length has its own pattern
+	atree = NewAnalyzer()
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq))
+	}
+
+	require.NoError(t, atree.Finalize())
+
+	seq, err := DefaultScanner.Tokenize(msgs[1], nil)
+	require.NoError(t, err)
+
+	aseq, err := atree.Analyze(seq)
+	require.NoError(t, err)
+	require.Equal(t, "%action% hosts %srcipv4% %dstipv4% from %object% %integer%", aseq.String())
+}
+
+func TestAnalyzerSeed(t *testing.T) {
+	msgs := []string{
+		"vpn session 7 from 10.0.0.1 closed for alice",
+		"vpn session 8 from 10.0.0.2 closed for bob",
+		"vpn tunnel up from 10.0.0.3",
+		"vpn tunnel down from 10.0.0.4",
+	}
+
+	for _, tc := range []struct {
+		seeds []string
+		pats  []string
+	}{
+		{
+			nil,
+			[]string{
+				"vpn %object% %integer% from %srcipv4% closed for %srcuser%",
+				"vpn %object% %integer% from %srcipv4% closed for %srcuser%",
+				"vpn tunnel %string% from %srcipv4%",
+				"vpn tunnel %string% from %srcipv4%",
+			},
+		},
+		{
+			// the messages take the shape, and the field names, of the known pattern,
+			// and the messages with another shape take its field names
+			[]string{"vpn session %integer% from %dstipv4% %string% for %dstuser%"},
+			[]string{
+				"vpn session %integer% from %dstipv4% %string% for %dstuser%",
+				"vpn session %integer% from %dstipv4% %string% for %dstuser%",
+				"vpn tunnel %string% from %dstipv4%",
+				"vpn tunnel %string% from %dstipv4%",
+			},
+		},
+		{
+			// the field used the most by the known patterns wins
+			[]string{
+				"vpn login from %srcipv4%",
+				"vpn logout from %dstipv4%",
+				"vpn reset from %dstipv4%",
+			},
+			[]string{
+				"vpn %object% %integer% from %dstipv4% closed for %srcuser%",
+				"vpn %object% %integer% from %dstipv4% closed for %srcuser%",
+				"vpn tunnel %string% from %dstipv4%",
+				"vpn tunnel %string% from %dstipv4%",
+			},
+		},
+		{
+			// the constrained tokens are seeded without their constraints
+			[]string{"vpn tunnel %action:up|down% from %srcipv4:10.0.0.0/8%"},
+			[]string{
+				"vpn %object% %integer% from %srcipv4% closed for %srcuser%",
+				"vpn %object% %integer% from %srcipv4% closed for %srcuser%",
+				"vpn tunnel %string% from %srcipv4%",
+				"vpn tunnel %string% from %srcipv4%",
+			},
+		},
+	} {
+		atree := NewAnalyzer()
+
+		for _, pat := range tc.seeds {
+			seq, err := DefaultScanner.Tokenize(pat, nil)
+			require.NoError(t, err)
+			require.NoError(t, atree.Seed(seq))
+		}
+
+		for _, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+			require.NoError(t, atree.Add(seq))
+		}
+
+		require.NoError(t, atree.Finalize())
+
+		for i, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+
+			seq, err = atree.Analyze(seq)
+			require.NoError(t, err, msg)
+			require.Equal(t, tc.pats[i], seq.String(), "%v: %s", tc.seeds, msg)
+		}
+	}
+
+	seq, err := DefaultScanner.Tokenize("vpn %nosuchfield%", nil)
+	require.NoError(t, err)
+	require.Error(t, NewAnalyzer().Seed(seq))
+}
+
+func TestAnalyzerAddInvalid(t *testing.T) {
+	atree := NewAnalyzer()
+
+	for _, msg := range []string{
+		"run %string{1,100}% done",
+		"run %nosuchfield% done",
+	} {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		require.Error(t, atree.Add(seq), msg)
+	}
+}
@@ -0,0 +1,588 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/strace/sequence"
+)
+
+var (
+	apiCmd = &cobra.Command{
+		Use:   "api",
+		Short: "api will serve scan, parse, analyze and pattern management over HTTP/JSON",
+	}
+
+	apiAddr       string
+	maxBodySize   int64
+	maxConcurrent int
+)
+
+func init() {
+	apiCmd.Flags().StringVarP(&apiAddr, "listen", "l", ":8080", "address to listen for HTTP requests")
+	apiCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, optional")
+	apiCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used, optional")
+	apiCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general or auto")
+	apiCmd.Flags().Int64VarP(&maxBodySize, "max-body", "", 10*int64(mbyte), "maximum size of a request body in bytes")
+	apiCmd.Flags().IntVarP(&maxConcurrent, "max-concurrent", "", 16, "maximum number of requests processed at the same time")
+	apiCmd.Flags().BoolVarP(&align, "align", "", false, "merge the patterns found by /analyze that only differ by some extra tokens into one")
+	apiCmd.Run = api
+}
+
+// apiRequest is the body of the scan, parse and analyze requests. Either a single
+// message or a batch of messages can be supplied. The results of a batch are
+// streamed back as newline delimited JSON, one object per message.
+type apiRequest struct {
+	Message  string   `json:"message,omitempty"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// apiPatternRequest is the body of the pattern create and update requests.
+type apiPatternRequest struct {
+	Pattern  string   `json:"pattern,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+type apiToken struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type apiResult struct {
+	Message   string     `json:"message,omitempty"`
+	Format    string     `json:"format,omitempty"`
+	PatternID string     `json:"pattern_id,omitempty"`
+	Pattern   string     `json:"pattern,omitempty"`
+	Tokens    []apiToken `json:"tokens,omitempty"`
+	Fields    []apiToken `json:"fields,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type apiCandidate struct {
+	PatternID string   `json:"pattern_id"`
+	Pattern   string   `json:"pattern"`
+	Count     int      `json:"count"`
+	Examples  []string `json:"examples"`
+}
+
+// apiServer holds the scanner and the parsers shared by all the requests. Each
+// message is parsed by the parser of its format, the same as in parse and serve.
+// The parsers can be changed through the pattern endpoints while other requests
+// are using them.
+type apiServer struct {
+	scanner sequence.Scanner
+	parsers map[string]*sequence.Parser
+	sem     chan struct{}
+}
+
+func api(cmd *cobra.Command, args []string) {
+	if format != "general" && format != "auto" {
+		log.Fatalf("The %s format is not supported by api", format)
+	}
+
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	scanner := buildScanner()
+
+	srv := &apiServer{
+		scanner: scanner,
+		parsers: buildFormatParsers(scanner),
+		sem:     make(chan struct{}, maxConcurrent),
+	}
+
+	hs := &http.Server{Addr: apiAddr, Handler: srv.handler()}
+
+	exitHooks = append(exitHooks, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		hs.Shutdown(ctx)
+	})
+
+	profile()
+
+	log.Printf("Serving HTTP API on %s", apiAddr)
+
+	if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	<-done
+}
+
+// handler returns the handler of all the endpoints
+func (this *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan", this.limit(this.scan))
+	mux.HandleFunc("/parse", this.limit(this.parse))
+	mux.HandleFunc("/analyze", this.limit(this.analyze))
+	mux.HandleFunc("/patterns", this.limit(this.patterns))
+	mux.HandleFunc("/patterns/", this.limit(this.pattern))
+
+	return mux
+}
+
+// parser returns the parser for the format of a message, or the one of the
+// --format if the format has none.
+func (this *apiServer) parser(mformat string) *sequence.Parser {
+	if p, ok := this.parsers[mformat]; ok {
+		return p
+	}
+
+	return this.parsers[format]
+}
+
+// allParsers returns each of the parsers once, the one of the --format first.
+func (this *apiServer) allParsers() []*sequence.Parser {
+	var list []*sequence.Parser
+
+	seen := make(map[*sequence.Parser]bool)
+
+	for _, p := range append([]*sequence.Parser{this.parsers[format]}, sortedParsers(this.parsers)...) {
+		if p != nil && !seen[p] {
+			seen[p] = true
+			list = append(list, p)
+		}
+	}
+
+	return list
+}
+
+// findPattern returns the pattern with the ID, from the first parser that has it.
+func (this *apiServer) findPattern(id string) (sequence.Sequence, error) {
+	for _, p := range this.allParsers() {
+		if pat, err := p.Pattern(id); err == nil {
+			return pat, nil
+		}
+	}
+
+	return nil, sequence.ErrNoPattern
+}
+
+// removePattern removes the pattern with the ID from all the parsers, and
+// returns ErrNoPattern if none of them has it.
+func (this *apiServer) removePattern(id string) error {
+	err := sequence.ErrNoPattern
+
+	for _, p := range this.allParsers() {
+		if p.Remove(id) == nil {
+			err = nil
+		}
+	}
+
+	return err
+}
+
+// limit rejects the request if there are already maxConcurrent requests being
+// processed, and limits the size of the request body to maxBodySize.
+func (this *apiServer) limit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case this.sem <- struct{}{}:
+			defer func() { <-this.sem }()
+
+		default:
+			w.Header().Set("Retry-After", "1")
+			apiError(w, http.StatusServiceUnavailable, "too many concurrent requests")
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		h(w, r)
+	}
+}
+
+// scan handles POST /scan, and returns the tokens of each message
+func (this *apiServer) scan(w http.ResponseWriter, r *http.Request) {
+	msgs, batch, ok := readMessages(w, r)
+	if !ok {
+		return
+	}
+
+	enc := newResultEncoder(w, batch)
+	seq := make(sequence.Sequence, 0, 20)
+
+	for _, msg := range msgs {
+		res := apiResult{Message: msg}
+
+		seq = seq[:0]
+		seq, mformat, err := tokenize(this.scanner, msg, seq)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.Format = mformat
+			res.Tokens = apiTokens(seq, false)
+		}
+
+		if !enc.encode(res) {
+			return
+		}
+	}
+}
+
+// parse handles POST /parse, and returns the fields of each message, as well as
+// the ID of the pattern that matched it
+func (this *apiServer) parse(w http.ResponseWriter, r *http.Request) {
+	msgs, batch, ok := readMessages(w, r)
+	if !ok {
+		return
+	}
+
+	enc := newResultEncoder(w, batch)
+	seq := make(sequence.Sequence, 0, 20)
+
+	for _, msg := range msgs {
+		res := apiResult{Message: msg}
+
+		seq = seq[:0]
+		seq, mformat, err := tokenize(this.scanner, msg, seq)
+		if err != nil {
+			res.Error = err.Error()
+		} else if pseq, id, err := this.parser(mformat).ParsePattern(seq); err != nil {
+			res.Format = mformat
+			res.Error = err.Error()
+		} else {
+			res.Format = mformat
+			res.PatternID = id
+			res.Pattern = pseq.String()
+			res.Fields = apiTokens(sequence.Decompose(pseq), true)
+		}
+
+		if !enc.encode(res) {
+			return
+		}
+	}
+}
+
+// analyze handles POST /analyze. The messages that are not parsed by the current
+// patterns are analyzed together, and the candidate patterns are streamed back,
+// each with the number of messages it matches and up to 3 examples.
+func (this *apiServer) analyze(w http.ResponseWriter, r *http.Request) {
+	msgs, _, ok := readMessages(w, r)
+	if !ok {
+		return
+	}
+
+	analyzer := sequence.NewAnalyzer(sequence.AnalyzerOptions{Align: align})
+	seqs := make([]sequence.Sequence, 0, len(msgs))
+	unparsed := make([]string, 0, len(msgs))
+
+	for _, msg := range msgs {
+		seq, mformat, err := tokenize(this.scanner, msg, nil)
+		if err != nil || len(seq) == 0 {
+			continue
+		}
+
+		if _, err := this.parser(mformat).Parse(seq); err == nil {
+			continue
+		}
+
+		analyzer.Add(seq)
+		seqs = append(seqs, seq)
+		unparsed = append(unparsed, msg)
+	}
+
+	analyzer.Finalize()
+
+	var candidates []*apiCandidate
+	cmap := make(map[string]*apiCandidate)
+
+	for i, seq := range seqs {
+		aseq, err := analyzer.Analyze(seq)
+		if err != nil {
+			continue
+		}
+
+		id := sequence.PatternID(aseq)
+
+		c, ok := cmap[id]
+		if !ok {
+			c = &apiCandidate{PatternID: id, Pattern: aseq.String()}
+			cmap[id] = c
+			candidates = append(candidates, c)
+		}
+
+		c.Count++
+		if len(c.Examples) < 3 {
+			c.Examples = append(c.Examples, unparsed[i])
+		}
+	}
+
+	enc := newResultEncoder(w, true)
+
+	for _, c := range candidates {
+		if !enc.encode(c) {
+			return
+		}
+	}
+}
+
+// patterns handles GET /patterns, which lists all the patterns, and POST /patterns,
+// which adds one or more patterns and returns their IDs.
+func (this *apiServer) patterns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		enc := newResultEncoder(w, true)
+		seen := make(map[string]bool)
+
+		for _, p := range this.allParsers() {
+			for _, id := range p.Patterns() {
+				if seen[id] {
+					continue
+				}
+
+				seen[id] = true
+
+				if pat, err := p.Pattern(id); err == nil {
+					if !enc.encode(apiResult{PatternID: id, Pattern: pat.String()}) {
+						return
+					}
+				}
+			}
+		}
+
+	case "POST":
+		pats, batch, ok := readPatterns(w, r)
+		if !ok {
+			return
+		}
+
+		res, ok := this.addPatterns(w, pats)
+		if !ok {
+			return
+		}
+
+		// the encoder sets the Content-Type, which has to be before the status
+		enc := newResultEncoder(w, batch)
+		w.WriteHeader(http.StatusCreated)
+
+		for _, pr := range res {
+			if !enc.encode(pr) {
+				return
+			}
+		}
+
+	default:
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// pattern handles GET, PUT and DELETE of /patterns/ID. Because the ID of a pattern
+// is derived from the pattern, PUT replaces the pattern and returns its new ID. The
+// old pattern is only removed once the new one is added.
+func (this *apiServer) pattern(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/patterns/")
+
+	pat, err := this.findPattern(id)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		newResultEncoder(w, false).encode(apiResult{PatternID: id, Pattern: pat.String()})
+
+	case "PUT":
+		pats, batch, ok := readPatterns(w, r)
+		if !ok {
+			return
+		} else if batch {
+			apiError(w, http.StatusBadRequest, "only a single pattern can replace a pattern")
+			return
+		}
+
+		res, ok := this.addPatterns(w, pats)
+		if !ok {
+			return
+		}
+
+		if res[0].PatternID != id {
+			this.removePattern(id)
+		}
+
+		newResultEncoder(w, false).encode(res[0])
+
+	case "DELETE":
+		if err := this.removePattern(id); err != nil {
+			apiError(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// addPatterns tokenizes all the patterns, and adds them to a scratch parser first,
+// so either all of them are added to the parsers, or none of them are. They are
+// added to the parsers of all the formats.
+func (this *apiServer) addPatterns(w http.ResponseWriter, pats []string) ([]apiResult, bool) {
+	seqs := make([]sequence.Sequence, 0, len(pats))
+	scratch := sequence.NewParser()
+
+	for _, pat := range pats {
+		seq, err := sequence.DefaultScanner.Tokenize(pat, nil)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		} else if len(seq) == 0 {
+			apiError(w, http.StatusBadRequest, "empty pattern")
+			return nil, false
+		} else if err := scratch.Add(seq); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	res := make([]apiResult, 0, len(seqs))
+
+	for _, seq := range seqs {
+		for _, p := range this.allParsers() {
+			if err := p.Add(seq); err != nil {
+				apiError(w, http.StatusInternalServerError, err.Error())
+				return nil, false
+			}
+		}
+
+		pat := sequence.AsPattern(seq)
+		res = append(res, apiResult{PatternID: sequence.PatternID(pat), Pattern: pat.String()})
+	}
+
+	return res, true
+}
+
+// readMessages decodes a POST request with a single message or a batch of messages.
+// If the request is invalid, an error is returned to the client, and ok is false.
+func readMessages(w http.ResponseWriter, r *http.Request) (msgs []string, batch, ok bool) {
+	if r.Method != "POST" {
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, false, false
+	}
+
+	var req apiRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return nil, false, false
+	}
+
+	if req.Messages != nil {
+		return req.Messages, true, true
+	}
+
+	if req.Message == "" {
+		apiError(w, http.StatusBadRequest, "message or messages is required")
+		return nil, false, false
+	}
+
+	return []string{req.Message}, false, true
+}
+
+// readPatterns decodes a request with a single pattern or a batch of patterns
+func readPatterns(w http.ResponseWriter, r *http.Request) (pats []string, batch, ok bool) {
+	var req apiPatternRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return nil, false, false
+	}
+
+	if req.Patterns != nil {
+		return req.Patterns, true, true
+	}
+
+	if req.Pattern == "" {
+		apiError(w, http.StatusBadRequest, "pattern or patterns is required")
+		return nil, false, false
+	}
+
+	return []string{req.Pattern}, false, true
+}
+
+// apiTokens converts the sequence to a list of tokens for the response. If named
+// is true, only the tokens with a field type, or a token type other than literal,
+// are returned.
+func apiTokens(seq sequence.Sequence, named bool) []apiToken {
+	toks := make([]apiToken, 0, len(seq))
+
+	for _, t := range seq {
+		if named && t.Field == sequence.FieldUnknown && (t.Type == sequence.TokenLiteral || t.Type == sequence.TokenUnknown) {
+			continue
+		}
+
+		toks = append(toks, apiToken{
+			Field: strings.Trim(t.Field.String(), "%"),
+			Type:  strings.Trim(t.Type.String(), "%"),
+			Value: t.Value,
+		})
+	}
+
+	return toks
+}
+
+// resultEncoder writes a single JSON object, or a stream of newline delimited
+// JSON objects that are flushed to the client as soon as they are written.
+type resultEncoder struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	batch   bool
+}
+
+func newResultEncoder(w http.ResponseWriter, batch bool) *resultEncoder {
+	if batch {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	return &resultEncoder{w: w, enc: json.NewEncoder(w), flusher: flusher, batch: batch}
+}
+
+// encode writes v, and returns false if the client has gone away.
+func (this *resultEncoder) encode(v interface{}) bool {
+	if err := this.enc.Encode(v); err != nil {
+		return false
+	}
+
+	if this.batch && this.flusher != nil {
+		this.flusher.Flush()
+	}
+
+	return true
+}
+
+func apiError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(apiResult{Error: msg})
+}
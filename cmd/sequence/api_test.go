@@ -0,0 +1,255 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/strace/sequence"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	apiClosedPattern = "%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%"
+	apiClosedMessage = "Jan 15 19:39:27 irc sshd[7779]: Connection closed by 108.61.8.125"
+)
+
+// newTestAPI returns an apiServer with a single parser, for the general format,
+// with the patterns.
+func newTestAPI(t *testing.T, pats ...string) *apiServer {
+	parser := sequence.NewParser()
+
+	for _, pat := range pats {
+		seq, err := sequence.DefaultScanner.Tokenize(pat, nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq))
+	}
+
+	return &apiServer{
+		scanner: sequence.DefaultScanner,
+		parsers: map[string]*sequence.Parser{format: parser},
+		sem:     make(chan struct{}, 1),
+	}
+}
+
+// apiDo sends the request to the handler, and returns the response.
+func apiDo(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+// apiResults decodes the newline delimited JSON results of a response.
+func apiResults(t *testing.T, w *httptest.ResponseRecorder) []apiResult {
+	var res []apiResult
+
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var r apiResult
+		require.NoError(t, dec.Decode(&r))
+		res = append(res, r)
+	}
+
+	return res
+}
+
+func TestAPIScan(t *testing.T) {
+	h := newTestAPI(t).handler()
+
+	w := apiDo(h, "POST", "/scan", `{"message": "`+apiClosedMessage+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+
+	res := apiResults(t, w)
+	require.Len(t, res, 1)
+	require.Equal(t, "general", res[0].Format)
+	require.Equal(t, "time", res[0].Tokens[0].Type)
+	require.Equal(t, "Jan 15 19:39:27", res[0].Tokens[0].Value)
+
+	w = apiDo(h, "POST", "/scan", `{"messages": ["`+apiClosedMessage+`", "a b c"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-ndjson", w.Result().Header.Get("Content-Type"))
+	require.Len(t, apiResults(t, w), 2)
+
+	for _, tc := range []struct {
+		method, body string
+		code         int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", `{"message": `, http.StatusBadRequest},
+		{"POST", `{}`, http.StatusBadRequest},
+	} {
+		w := apiDo(h, tc.method, "/scan", tc.body)
+		require.Equal(t, tc.code, w.Code, tc.body)
+		require.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+		require.NotEqual(t, "", apiResults(t, w)[0].Error, tc.body)
+	}
+}
+
+func TestAPIParse(t *testing.T) {
+	h := newTestAPI(t, apiClosedPattern).handler()
+
+	w := apiDo(h, "POST", "/parse", `{"messages": ["`+apiClosedMessage+`", "no such message"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	res := apiResults(t, w)
+	require.Len(t, res, 2)
+	require.Equal(t, apiClosedPattern, res[0].Pattern)
+	require.NotEqual(t, "", res[0].PatternID)
+	require.Equal(t, "", res[0].Error)
+	require.Contains(t, res[0].Fields, apiToken{Field: "srcipv4", Type: "ipv4", Value: "108.61.8.125"})
+	require.Equal(t, "", res[1].PatternID)
+	require.NotEqual(t, "", res[1].Error)
+}
+
+func TestAPIAnalyze(t *testing.T) {
+	h := newTestAPI(t, apiClosedPattern).handler()
+
+	w := apiDo(h, "POST", "/analyze", `{"messages": [
+		"`+apiClosedMessage+`",
+		"Jan 15 19:39:26 irc sshd[7778]: Invalid user admin from 108.61.8.124",
+		"Jan 15 19:39:28 irc sshd[7780]: Invalid user guest from 108.61.8.126"
+	]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-ndjson", w.Result().Header.Get("Content-Type"))
+
+	var c apiCandidate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&c))
+	require.Equal(t, 2, c.Count)
+	require.Len(t, c.Examples, 2)
+	require.Contains(t, c.Pattern, "invalid user")
+}
+
+func TestAPIPatterns(t *testing.T) {
+	srv := newTestAPI(t)
+	h := srv.handler()
+
+	w := apiDo(h, "POST", "/patterns", `{"pattern": "`+apiClosedPattern+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+
+	res := apiResults(t, w)
+	require.Len(t, res, 1)
+	require.Equal(t, apiClosedPattern, res[0].Pattern)
+	id := res[0].PatternID
+
+	// a batch is all or nothing
+	w = apiDo(h, "POST", "/patterns", `{"patterns": ["job %integer% started", "job %nosuchfield% stopped"]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, srv.parser(format).Patterns(), 1)
+
+	w = apiDo(h, "POST", "/patterns", `{"patterns": ["job %integer% started", "job %integer% stopped"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "application/x-ndjson", w.Result().Header.Get("Content-Type"))
+	require.Len(t, apiResults(t, w), 2)
+
+	w = apiDo(h, "GET", "/patterns", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, apiResults(t, w), 3)
+
+	w = apiDo(h, "GET", "/patterns/"+id, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, apiClosedPattern, apiResults(t, w)[0].Pattern)
+
+	// the replaced pattern has a new ID, and the old one is removed
+	w = apiDo(h, "PUT", "/patterns/"+id, `{"pattern": "`+apiClosedPattern+` port %srcport%"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	newID := apiResults(t, w)[0].PatternID
+	require.NotEqual(t, id, newID)
+
+	w = apiDo(h, "GET", "/patterns/"+id, "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = apiDo(h, "PUT", "/patterns/"+newID, `{"patterns": ["job %integer% done"]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = apiDo(h, "PUT", "/patterns/"+newID, `{"pattern": "job %nosuchfield% done"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = apiDo(h, "DELETE", "/patterns/"+newID, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = apiDo(h, "DELETE", "/patterns/"+newID, "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = apiDo(h, "PATCH", "/patterns", "")
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	require.Len(t, srv.parser(format).Patterns(), 2)
+}
+
+func TestAPILimits(t *testing.T) {
+	defer func(n int64) { maxBodySize = n }(maxBodySize)
+	maxBodySize = 32
+
+	srv := newTestAPI(t)
+	h := srv.handler()
+
+	w := apiDo(h, "POST", "/scan", `{"message": "a b c"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = apiDo(h, "POST", "/scan", `{"message": "`+apiClosedMessage+`"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the only slot is taken by another request
+	srv.sem <- struct{}{}
+
+	w = apiDo(h, "POST", "/scan", `{"message": "a b c"}`)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Result().Header.Get("Retry-After"))
+
+	<-srv.sem
+
+	w = apiDo(h, "POST", "/scan", `{"message": "a b c"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAPIFormats(t *testing.T) {
+	defer func(f string) { format = f }(format)
+	format = "auto"
+
+	// the general format has its own patterns, as with a general subdirectory
+	general := sequence.NewParser()
+	seq, err := sequence.DefaultScanner.Tokenize(apiClosedPattern, nil)
+	require.NoError(t, err)
+	require.NoError(t, general.Add(seq))
+
+	srv := &apiServer{
+		scanner: sequence.NewMultiScanner(),
+		parsers: map[string]*sequence.Parser{format: sequence.NewParser(), sequence.FormatGeneral: general},
+		sem:     make(chan struct{}, 1),
+	}
+	h := srv.handler()
+
+	w := apiDo(h, "POST", "/parse", `{"message": "`+apiClosedMessage+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	res := apiResults(t, w)
+	require.Equal(t, sequence.FormatGeneral, res[0].Format)
+	require.Equal(t, apiClosedPattern, res[0].Pattern)
+
+	// the added patterns apply to all the formats
+	w = apiDo(h, "POST", "/patterns", `{"pattern": "job %integer% started"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, srv.parsers[format].Patterns(), 1)
+	require.Len(t, general.Patterns(), 2)
+
+	w = apiDo(h, "GET", "/patterns", "")
+	require.Len(t, apiResults(t, w), 2)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/strace/sequence"
+)
+
+var (
+	compareCmd = &cobra.Command{
+		Use:   "compare",
+		Short: "compare will parse the messages with an old and a new set of patterns, and report the messages that are parsed differently",
+	}
+
+	oldpats   string
+	newpats   string
+	samples   int
+	reportfmt string
+	failOn    string
+
+	changeTitles = map[string]string{
+		"matched":   "Newly matched",
+		"unmatched": "Newly unmatched",
+		"pattern":   "Matched by a different pattern",
+		"fields":    "Changed field values",
+	}
+)
+
+func init() {
+	compareCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
+	compareCmd.Flags().StringVarP(&oldpats, "old", "", "", "old pattern file or directory, required")
+	compareCmd.Flags().StringVarP(&newpats, "new", "", "", "new pattern file or directory, required")
+	compareCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	compareCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	compareCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
+	compareCmd.Flags().IntVarP(&samples, "samples", "n", 5, "number of sample messages to report for each kind of change")
+	compareCmd.Flags().StringVarP(&reportfmt, "report", "r", "text", "report format: text or json")
+	compareCmd.Flags().StringVarP(&failOn, "fail-on", "", "", "comma separated list of changes that fail the run: matched, unmatched, pattern or fields")
+	compareCmd.Run = compare
+}
+
+// compare parses the messages with the parsers of the old and new patterns, and
+// writes the report of the messages that are parsed differently. It exits with
+// status 1 if there are any of the changes in --fail-on.
+func compare(cmd *cobra.Command, args []string) {
+	if oldpats == "" || newpats == "" {
+		log.Fatal("Both --old and --new are required")
+	}
+
+	if reportfmt != "text" && reportfmt != "json" {
+		log.Fatalf("Unknown report format %q, must be text or json", reportfmt)
+	}
+
+	var kinds []sequence.ChangeKind
+
+	if failOn != "" {
+		for _, name := range strings.Split(failOn, ",") {
+			kind := sequence.ChangeKindFromString(strings.TrimSpace(name))
+			if kind <= sequence.Unchanged {
+				log.Fatalf("Unknown change %q in --fail-on, must be matched, unmatched, pattern or fields", name)
+			}
+
+			kinds = append(kinds, kind)
+		}
+	}
+
+	scanner := buildScanner()
+	cmp := sequence.NewComparison(buildParserFromFiles(patternFiles(oldpats)), buildParserFromFiles(patternFiles(newpats)), samples)
+	seq := make(sequence.Sequence, 0, 20)
+
+	lineSource(infile)(func(line string) {
+		seq = seq[:0]
+		seq, _, err := tokenize(scanner, line, seq)
+		if err != nil {
+			log.Fatal(err)
+		} else if len(seq) == 0 {
+			return
+		}
+
+		cmp.Compare(seq, line)
+	})
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	r := cmp.Report()
+
+	if reportfmt == "json" {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		output(ofile, "%s\n", data)
+	} else {
+		output(ofile, "Compared %d messages, %d are parsed the same\n", r.Messages, r.Unchanged)
+
+		for _, c := range r.Changes {
+			output(ofile, "\n%s: %d\n", changeTitles[c.Kind], c.Count)
+
+			for _, s := range c.Samples {
+				output(ofile, "  %s\n", s.Message)
+
+				if s.OldPattern != "" {
+					output(ofile, "    old: %s\n", s.OldPattern)
+				}
+
+				if s.NewPattern != "" {
+					output(ofile, "    new: %s\n", s.NewPattern)
+				}
+
+				if s.Fields != "" {
+					output(ofile, "    fields: %s\n", s.Fields)
+				}
+			}
+		}
+	}
+
+	var failed bool
+
+	for _, kind := range kinds {
+		if n := cmp.Count(kind); n > 0 {
+			log.Printf("%s: %d messages", changeTitles[kind.String()], n)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// patternFiles returns the files in the directory, if the path is one, or the
+// path itself.
+func patternFiles(path string) []string {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return getDirOfFiles(path)
+	}
+
+	return []string{path}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/strace/sequence"
+)
+
+// learners are the learners of parse --learn, one for each of the format parsers,
+// in the order they first have an unmatched message.
+type learners struct {
+	list     []*sequence.Learner
+	byParser map[*sequence.Parser]*sequence.Learner
+	n        int
+}
+
+func newLearners() *learners {
+	return &learners{byParser: make(map[*sequence.Parser]*sequence.Learner)}
+}
+
+// add adds the message the parser couldn't match to its learner, and writes the
+// proposed patterns every --learn-every messages.
+func (this *learners) add(parser *sequence.Parser, seq sequence.Sequence, line string) {
+	l, ok := this.byParser[parser]
+	if !ok {
+		l = sequence.NewLearner(parser, sequence.AnalyzerOptions{Align: align})
+		this.byParser[parser] = l
+		this.list = append(this.list, l)
+	}
+
+	l.Add(seq, line)
+	this.n++
+
+	if learnEvery > 0 && this.n%learnEvery == 0 {
+		this.write()
+	}
+}
+
+// write writes the patterns proposed by the learners to the --learnfile, in the
+// pattern file format, with the number of messages of each pattern as a comment
+// before it, and the example messages after it. Patterns that are accepted, with
+// --learn-accept, are added to the parsers as well.
+func (this *learners) write() {
+	var cands []sequence.Candidate
+
+	for _, l := range this.list {
+		c, err := l.Learn(autoAccept)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cands = append(cands, c...)
+	}
+
+	ofile, err := os.Create(learnfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ofile.Close()
+
+	var accepted int
+
+	for _, c := range cands {
+		if c.ID != "" {
+			accepted++
+			patternSources[c.ID] = learnfile
+			output(ofile, "# %d messages, accepted\n", c.Count)
+		} else {
+			output(ofile, "# %d messages\n", c.Count)
+		}
+
+		output(ofile, "%s\n", c.Pattern)
+		for _, ex := range c.Examples {
+			output(ofile, "# %s\n", ex)
+		}
+		output(ofile, "\n")
+	}
+
+	log.Printf("Learned %d patterns from %d unmatched messages, %d are accepted, written to %s", len(cands), this.n, accepted, learnfile)
+}
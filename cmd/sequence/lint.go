@@ -0,0 +1,109 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/strace/sequence"
+)
+
+var (
+	lintCmd = &cobra.Command{
+		Use:   "lint [pattern files]",
+		Short: "lint will check pattern files for unknown tags, duplicate, shadowed and overly generic patterns",
+	}
+
+	strict bool
+)
+
+func init() {
+	lintCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file")
+	lintCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
+	lintCmd.Flags().BoolVarP(&strict, "strict", "", false, "exit with a non-zero status for warnings as well as errors")
+	lintCmd.Run = lint
+}
+
+// lint checks the pattern files the same way parse loads them. The patterns in a
+// format subdirectory of the pattern directory are checked along with the ones
+// in the directory itself, but only their own problems are reported. It exits
+// with status 1 if there are errors, or warnings with --strict.
+func lint(cmd *cobra.Command, args []string) {
+	var files []string
+
+	if patdir != "" {
+		files = getDirOfFiles(patdir)
+	}
+
+	if patfile != "" {
+		files = append(files, patfile)
+	}
+
+	files = append(files, args...)
+
+	if len(files) == 0 {
+		log.Fatal("At least one of --patdir, --patfile or a pattern file is required")
+	}
+
+	issues := sequence.LintFiles(files)
+
+	if patdir != "" {
+		dirs, err := ioutil.ReadDir(patdir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, d := range dirs {
+			if !d.IsDir() {
+				continue
+			}
+
+			own := make(map[string]bool)
+			sub := getDirOfFiles(patdir + "/" + d.Name())
+
+			for _, f := range sub {
+				own[f] = true
+			}
+
+			for _, issue := range sequence.LintFiles(append(append([]string(nil), files...), sub...)) {
+				if own[issue.File] {
+					issues = append(issues, issue)
+				}
+			}
+		}
+	}
+
+	var errs, warns int
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+
+		if issue.Severity == sequence.LintError {
+			errs++
+		} else {
+			warns++
+		}
+	}
+
+	log.Printf("Checked %d pattern files, found %d errors and %d warnings", len(files), errs, warns)
+
+	if errs > 0 || (strict && warns > 0) {
+		os.Exit(1)
+	}
+}
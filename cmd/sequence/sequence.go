@@ -27,19 +27,32 @@
 //      scan                      scan will tokenize a log file or message and output a list of tokens
 //      analyze                   analyze will analyze a log file and output a list of patterns that will match all the log messages
 //      parse                     parse will parse a log file and output a list of parsed tokens for each of the log messages
+//      serve                     serve will receive syslog messages over the network and output a list of parsed tokens for each of them
+//      api                       api will serve scan, parse, analyze and pattern management over HTTP/JSON
 //      bench                     benchmark scanning or parsing, no output is provided
 //		  scan                    benchmark the scanning of a log file, no output is provided
 // 		  parse                   benchmark the parsing of a log file, no output is provided
 //      help [command]            Help about any command
 //
+// All the commands that read log files read from stdin if the input file is not
+// given, or is `-`, and write to stdout if the output file is not given. Results are
+// written out as soon as each message is processed, so `sequence` can be part of a
+// pipeline, e.g., `tail -F /var/log/auth.log | sequence parse -d patterns`. `analyze`
+// needs to go through the messages twice, so it keeps the messages from stdin in
+// memory until the input ends.
+//
 // ### Scan
 //
 //   Usage:
 //     sequence scan [flags]
 //
 //    Available Flags:
+//         --columns="": comma separated list of columns for w3c, csv or tsv formats
+//     -f, --format="general": message format: general, auto, w3c, csv or tsv
 //     -h, --help=false: help for scan
+//     -i, --infile="": input file, if no message, from the file, or if empty or -, from stdin
 //     -m, --msg="": message to tokenize
+//     -o, --outfile="": output file, if empty, to stdout
 //
 // Example
 //
@@ -75,11 +88,24 @@
 //     sequence analyze [flags]
 //
 //    Available Flags:
+//         --align=false: tree: merge the patterns that only differ by some extra tokens into one
+//         --columns="": comma separated list of columns for w3c, csv or tsv formats
+//         --depth=1: drain: number of leading tokens used to group the messages
+//     -e, --engine="tree": pattern discovery engine: tree or drain
+//     -f, --format="general": message format: general, auto, w3c, csv or tsv
 //     -h, --help=false: help for analyze
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
+//         --max-children=100: drain: most children of a node in the tree
+//         --min-repeat=0: least number of tokens of the same type in a row to be taken as a repeated token, 0 to disable
+//         --min-support=0: least number of messages a literal must be seen in to be merged into a variable
+//         --min-values=2: least number of distinct literals in a position for them to be merged into a variable
 //     -o, --outfile="": output file, if empty, to stdout
 //     -d, --patdir="": pattern directory,, all files in directory will be used, optional
 //     -p, --patfile="": initial pattern file, optional
+//         --protect="": comma separated list of literals that are never merged into a variable
+//         --rest-branches=0: least number of distinct tokens after a literal for the rest of the message to be taken as free-form text, 0 to disable
+//         --seed=false: seed the analyzer with the patterns in the pattern file and directory, tree engine only
+//         --similarity=0.5: drain: least fraction of the same tokens for a message to join a cluster
 // ```
 //
 // The following command analyzes a set of sshd log messages, and output the
@@ -116,17 +142,71 @@
 //   $ ./sequence analyze -d ../../patterns -i ../../data/sshd.all  -o sshd.pat
 //   Analyzed 212897 messages, found 35 unique patterns, 0 are new.
 //
+// With `--seed`, the known patterns are also used to seed the analyzer, so the new
+// patterns are consistent with them. Their literals are kept, the literals in the
+// same position as their `%string%` tokens become variables, and a token that
+// follows the same literal as one of their fields, and has the same type, is named
+// after the field, e.g., the `%ipv4%` after `from` is `%dstipv4%` if that's what the
+// known patterns call it. Their constrained tokens, e.g., `%action:allow|deny%`, are
+// taken as variables without the constraints.
+//
+// By default, the analyzer turns any two literals in the same position that share a
+// parent and a child into a variable, even if each is seen only once. With
+// `--min-values`, there must be at least that many distinct literals, and with
+// `--min-support`, a literal must be seen in at least that many messages to be
+// merged, so rare messages keep their literals. `--protect` lists literals that are
+// never merged, e.g., `--protect accepted,failed`.
+//
+// With `--min-repeat`, tokens of the same type in a row, at least that many of them,
+// are taken as one token that repeats, so lists of different lengths, e.g., of IP
+// addresses, have a single pattern with `%srcipv4+%`. And with `--rest-branches`, if
+// a literal is followed by at least that many distinct tokens that only have
+// literals after them, the rest of those messages is taken as free-form text, e.g.,
+// the reasons in
+//
+//   %msgtime% %apphost% %appname% [ %sessionid% ] : job %status% : %string-%
+//
+// With `-e drain`, the patterns are found by clustering the messages instead, based
+// on Drain, "An Online Log Parsing Approach with Fixed Depth Tree". Messages with
+// the same number of tokens, and the same first `--depth` tokens, are grouped into
+// clusters of messages that have at least `--similarity` of their tokens in
+// common, and the tokens that differ within a cluster become variables. The patterns
+// are written the same way, so the two engines can be compared on the same messages.
+// `--min-values`, `--min-support`, `--protect` and `--align` only apply to the
+// `tree` engine.
+//
+// Either way, messages with a different number of tokens get different patterns,
+// e.g., `session closed for user bob` and `session closed for user bob by admin`.
+// With `--align`, the new patterns that have all the tokens of a shorter one, in
+// the same order, are merged into it, and the tokens only some of them have become
+// `%string?%` or `%string{0,n}%` in between the others, and `%string-%` or
+// `%string{0,}%` at the end, e.g.,
+//
+//   session closed for user %string-%
+//
 // ### Parse
 //
 //   Usage:
 //     sequence parse [flags]
 //
 //    Available Flags:
+//         --columns="": comma separated list of columns for w3c, csv or tsv formats
+//     -f, --format="general": message format: general, auto, w3c, csv or tsv
 //     -h, --help=false: help for parse
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
+//         --align=false: with --learn, merge the proposed patterns that only differ by some extra tokens into one
+//         --learn=false: propose patterns for the messages that aren't matched
+//         --learn-accept=0: add the proposed patterns for at least this many messages to the parser, if 0, none are added
+//         --learn-every=0: write the proposed patterns every this many unmatched messages, if 0, only at the end
+//         --learnfile="learned.txt": file to write the proposed patterns to, for review
+//         --min-coverage=0: exit with a non-zero status if less than this percentage of the messages are matched
 //     -o, --outfile="": output file, if empty, to stdout
 //     -d, --patdir="": pattern directory,, all files in directory will be used
 //     -p, --patfile="": initial pattern file, required
+//     -s, --schema="": output JSON documents in this schema: ecs or ocsf
+//         --schemafile="": TOML file that overrides or adds to the schema mappings
+//         --stats="": print a summary of the coverage and pattern hits: text or json
+//         --statsfile="": file to write the summary to, if empty, to stderr
 //
 // The following command parses a file based on existing rules. Note that the
 // performance number (9570.20 msgs/sec) is mostly due to reading/writing to disk.
@@ -164,6 +244,124 @@
 //   #  23: { Field="%funknown%", Type="%integer%", Value="0" }
 //   #  24: { Field="%funknown%", Type="%literal%", Value=")" }
 //
+// Pattern files can declare custom fields, in addition to the built-in ones, with
+// the `@field` directive, followed by the field name and the token type of its
+// values, e.g., `@field %vlan% %integer%`. The field can then be used in the
+// patterns that follow, in any of the pattern files. A `%tag%` that's neither a
+// field nor a token type is an error.
+//
+// With `-s`, each parsed message is written as a single line JSON document in the
+// Elastic Common Schema (`ecs`) or the Open Cybersecurity Schema Framework (`ocsf`),
+// e.g., `%srcipv4%` becomes `source.ip` in ECS, and `src_endpoint.ip` in OCSF. The
+// message, the pattern and the pattern ID are included as well. Fields that the
+// schema doesn't map are placed under `labels` (ECS) or `unmapped` (OCSF), and so
+// are the timestamps, e.g., `%msgtime%`, that can't be parsed. The others are
+// written in RFC 3339. The mappings can be changed, or new schemas added, with a
+// TOML file supplied with `--schemafile`, in the format described in `LoadSchemas`
+// in schema.go.
+//
+// URLs, e.g., `%url%`, are broken into their parts, which are added to the parsed
+// message as the `%urlscheme%`, `%urlhost%`, `%urlport%`, `%urlpath%`, `%urlquery%`
+// and `%urlfragment%` fields, followed by the `%urlparam%` and `%urlparamval%`
+// fields for the name and value of each query parameter.
+//
+// The `-f` flag selects the message format. `w3c` reads the column order from
+// the `#Fields:` directives in the file, while `csv` and `tsv` use the columns
+// supplied with `--columns`, e.g., `--columns c-ip,cs-username,srcport`. The
+// `time-taken` column is in milliseconds, e.g., 1593 is read as `1593ms`. `auto`
+// detects the format of each message, JSON, CEF, key=value or general, and adds a
+// `# format:` line to each entry. With `auto`, patterns in a subdirectory of the
+// pattern directory that's named after the format, e.g., `patterns/json`, only
+// apply to messages of that format.
+//
+// With `--stats`, a summary of the run is written to stderr, or the `--statsfile`,
+// as `text` or `json`. It has the percentage of the messages that are matched, the
+// number of messages each pattern matched, with the file and line it's defined at,
+// the patterns that matched none, and the unmatched messages grouped by their
+// signature, with an example of each. `--min-coverage` makes the run exit with
+// status 1 if less than that percentage of the messages are matched, e.g., in CI.
+//
+// With `--learn`, the messages that aren't matched are analyzed, the same way as
+// `analyze` does, and the patterns proposed for them are written to the
+// `--learnfile`, at the end of the run, or every `--learn-every` unmatched messages,
+// to be reviewed and copied to the pattern files. Each pattern is preceded by the
+// number of messages it's proposed for, and followed by some of them as examples,
+// so the file can be checked with `test`. With `--learn-accept`, the patterns
+// proposed for at least that many messages are also added to the parser, and match
+// the messages that follow, in the same run. They are marked as accepted in the
+// file. Only the first 100 unmatched messages with each signature are kept, and
+// analyzed, the rest are counted, so a long run doesn't run out of memory.
+//
+// ```
+//   $ ./sequence parse -d ../../patterns -i ../../data/sshd.all -o parsed.sshd --learn --learn-every 10000 --learn-accept 100
+// ```
+//
+// ### Serve
+//
+//   Usage:
+//     sequence serve [flags]
+//
+//    Available Flags:
+//         --cert="": TLS certificate file
+//     -f, --format="general": message format: general or auto
+//     -h, --help=false: help for serve
+//         --key="": TLS private key file
+//     -o, --outfile="": output file, appended to, if empty, to stdout
+//     -d, --patdir="": pattern directory,, all files in directory will be used
+//     -p, --patfile="": initial pattern file, required
+//     -t, --tcp="": address to receive syslog over TCP, e.g., :514
+//         --tls="": address to receive syslog over TLS, e.g., :6514, requires --cert and --key
+//     -u, --udp="": address to receive syslog over UDP, e.g., :514
+//     -w, --workers=1: number of parsing workers
+//
+// `serve` runs `sequence` as a syslog receiver. Each UDP datagram is a message,
+// while TCP and TLS streams can use either octet counting or newline framing, as
+// described in RFC6587. The `<PRI>` prefix is removed before the message is parsed,
+// and recorded as `%priority%`. If the matching pattern has no `%appipv4%`, the
+// address of the sender is recorded as `%appipv4%`. The output has the same format
+// as `parse`. `serve` runs until it receives an interrupt or terminate signal, at
+// which point it stops receiving, and writes out the messages already received.
+//
+//   $ ./sequence serve -d ../../patterns -u :5514 -t :5514 -w 4 -o parsed.log
+//
+// ### Api
+//
+//   Usage:
+//     sequence api [flags]
+//
+//    Available Flags:
+//         --align=false: merge the patterns found by /analyze that only differ by some extra tokens into one
+//     -f, --format="general": message format: general or auto
+//     -h, --help=false: help for api
+//     -l, --listen=":8080": address to listen for HTTP requests
+//         --max-body=10485760: maximum size of a request body in bytes
+//         --max-concurrent=16: maximum number of requests processed at the same time
+//     -d, --patdir="": pattern directory,, all files in directory will be used, optional
+//     -p, --patfile="": initial pattern file, optional
+//
+// `api` serves the scanner, parser and analyzer over HTTP/JSON, with these endpoints:
+//
+//   POST   /scan            {"message": "..."} or {"messages": [...]}, returns the tokens
+//   POST   /parse           {"message": "..."} or {"messages": [...]}, returns the fields and the pattern ID
+//   POST   /analyze         {"messages": [...]}, returns candidate patterns for the messages not parsed
+//   GET    /patterns        lists the patterns and their IDs
+//   POST   /patterns        {"pattern": "..."} or {"patterns": [...]}, adds patterns and returns their IDs
+//   GET    /patterns/ID     returns the pattern
+//   PUT    /patterns/ID     {"pattern": "..."}, replaces the pattern and returns its new ID
+//   DELETE /patterns/ID     removes the pattern
+//
+// A single message returns a single JSON object. A batch of messages, as well as the
+// pattern list and the analyze results, are streamed back as newline delimited JSON,
+// one object per line. The ID of a pattern is derived from the pattern, so the same
+// pattern has the same ID across restarts. Requests over the `--max-concurrent`
+// limit are rejected with status 503. With `-f auto`, each message is parsed with the
+// patterns of its format, the same as `parse`, and the patterns added through the
+// API apply to all the formats.
+//
+//   $ ./sequence api -d ../../patterns -l :8080
+//   $ curl -XPOST localhost:8080/parse -d '{"message": "Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2"}'
+//   {"message":"Jan 15 19:39:26 irc sshd[7778]: ...","format":"general","pattern_id":"8318aba5ad321a8f","pattern":"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %dstuser% from %srcipv4% port %srcport% ssh2","fields":[{"field":"msgtime","type":"time","value":"Jan 15 19:39:26"}, ...]}
+//
 // ### Benchmark
 //
 //   Usage:
@@ -177,18 +375,22 @@
 //     sequence bench scan [flags]
 //
 //    Available Flags:
+//         --columns="": comma separated list of columns for w3c, csv or tsv formats
 //     -c, --cpuprofile="": CPU profile filename
+//     -f, --format="general": message format: general, auto, w3c, csv or tsv
 //     -h, --help=false: help for bench
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
 //     -w, --workers=1: number of parsing workers
 //
 //   Usage:
 //     sequence bench parse [flags]
 //
 //    Available Flags:
+//         --columns="": comma separated list of columns for w3c, csv or tsv formats
 //     -c, --cpuprofile="": CPU profile filename
+//     -f, --format="general": message format: general, auto, w3c, csv or tsv
 //     -h, --help=false: help for bench
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
 //     -d, --patdir="": pattern directory,, all files in directory will be used
 //     -p, --patfile="": pattern file, required
 //     -w, --workers=1: number of parsing workers
@@ -221,6 +423,7 @@ package main
 import (
 	"bufio"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -229,6 +432,7 @@ import (
 	"runtime/pprof"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -279,51 +483,125 @@ var (
 	patdir     string
 	cpuprofile string
 	workers    int
+	format     string
+	columns    string
+	schema     string
+	schemafile string
+	stats      string
+	statsfile  string
+	minCover   float64
+	learn      bool
+	learnfile  string
+	learnEvery int
+	autoAccept int
+	minValues  int
+	minSupport int
+	protected  string
+	minRepeat  int
+	restBranch int
+	engine     string
+	depth      int
+	similarity float64
+	maxKids    int
+	align      bool
+	seed       bool
+
+	// patternSources is the file and line each pattern loaded into the parsers
+	// is first defined at, by pattern ID
+	patternSources = make(map[string]string)
 
 	quit chan struct{}
 	done chan struct{}
 
+	// exitHooks are called, in order, when the program is quitting or a signal
+	// is trapped, before the process exits
+	exitHooks []func()
+
+	// exitStatus is the status the process exits with after the exit hooks
+	exitStatus int
+
 	mbyte = 1024 * 1024
 )
 
+// maxLineSize is the longest line that can be read from an input file
+const maxLineSize = 1024 * 1024
+
 func init() {
 	quit = make(chan struct{})
 	done = make(chan struct{})
 
 	scanCmd.Flags().StringVarP(&inmsg, "msg", "m", "", "message to tokenize")
+	scanCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if no message, from the file, or if empty or -, from stdin")
+	scanCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	scanCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	scanCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
 	scanCmd.Run = scan
 
-	analyzeCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required")
+	analyzeCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	analyzeCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, optional")
 	analyzeCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used, optional")
 	analyzeCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	analyzeCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	analyzeCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
+	analyzeCmd.Flags().IntVarP(&minValues, "min-values", "", 2, "least number of distinct literals in a position for them to be merged into a variable")
+	analyzeCmd.Flags().IntVarP(&minSupport, "min-support", "", 0, "least number of messages a literal must be seen in to be merged into a variable")
+	analyzeCmd.Flags().StringVarP(&protected, "protect", "", "", "comma separated list of literals that are never merged into a variable")
+	analyzeCmd.Flags().IntVarP(&minRepeat, "min-repeat", "", 0, "least number of tokens of the same type in a row to be taken as a repeated token, 0 to disable")
+	analyzeCmd.Flags().IntVarP(&restBranch, "rest-branches", "", 0, "least number of distinct tokens after a literal for the rest of the message to be taken as free-form text, 0 to disable")
+	analyzeCmd.Flags().StringVarP(&engine, "engine", "e", "tree", "pattern discovery engine: tree or drain")
+	analyzeCmd.Flags().IntVarP(&depth, "depth", "", 1, "drain: number of leading tokens used to group the messages")
+	analyzeCmd.Flags().Float64VarP(&similarity, "similarity", "", 0.5, "drain: least fraction of the same tokens for a message to join a cluster")
+	analyzeCmd.Flags().IntVarP(&maxKids, "max-children", "", 100, "drain: most children of a node in the tree")
+	analyzeCmd.Flags().BoolVarP(&align, "align", "", false, "tree: merge the patterns that only differ by some extra tokens into one")
+	analyzeCmd.Flags().BoolVarP(&seed, "seed", "", false, "seed the analyzer with the patterns in the pattern file and directory, tree engine only")
 	analyzeCmd.Run = analyze
 
-	parseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required ")
+	parseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	parseCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, required")
 	parseCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
 	parseCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	parseCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	parseCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
+	parseCmd.Flags().StringVarP(&schema, "schema", "s", "", "output JSON documents in this schema: ecs or ocsf")
+	parseCmd.Flags().StringVarP(&schemafile, "schemafile", "", "", "TOML file that overrides or adds to the schema mappings")
+	parseCmd.Flags().StringVarP(&stats, "stats", "", "", "print a summary of the coverage and pattern hits: text or json")
+	parseCmd.Flags().StringVarP(&statsfile, "statsfile", "", "", "file to write the summary to, if empty, to stderr")
+	parseCmd.Flags().Float64VarP(&minCover, "min-coverage", "", 0, "exit with a non-zero status if less than this percentage of the messages are matched")
+	parseCmd.Flags().BoolVarP(&learn, "learn", "", false, "propose patterns for the messages that aren't matched")
+	parseCmd.Flags().BoolVarP(&align, "align", "", false, "with --learn, merge the proposed patterns that only differ by some extra tokens into one")
+	parseCmd.Flags().StringVarP(&learnfile, "learnfile", "", "learned.txt", "file to write the proposed patterns to, for review")
+	parseCmd.Flags().IntVarP(&learnEvery, "learn-every", "", 0, "write the proposed patterns every this many unmatched messages, if 0, only at the end")
+	parseCmd.Flags().IntVarP(&autoAccept, "learn-accept", "", 0, "add the proposed patterns for at least this many messages to the parser, if 0, none are added")
 	parseCmd.Run = parse
 
 	benchCmd.AddCommand(benchScanCmd)
 	benchCmd.AddCommand(benchParseCmd)
 
-	benchScanCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required ")
+	benchScanCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	benchScanCmd.Flags().StringVarP(&cpuprofile, "cpuprofile", "c", "", "CPU profile filename")
 	benchScanCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of parsing workers")
+	benchScanCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	benchScanCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
 	benchScanCmd.Run = benchScan
 
-	benchParseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required ")
+	benchParseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	benchParseCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file, required")
 	benchParseCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
 	benchParseCmd.Flags().StringVarP(&cpuprofile, "cpuprofile", "c", "", "CPU profile filename")
 	benchParseCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of parsing workers")
+	benchParseCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general, auto, w3c, csv or tsv")
+	benchParseCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
 	benchParseCmd.Run = benchParse
 
 	sequenceCmd.AddCommand(scanCmd)
 	sequenceCmd.AddCommand(analyzeCmd)
 	sequenceCmd.AddCommand(parseCmd)
 	sequenceCmd.AddCommand(benchCmd)
+	sequenceCmd.AddCommand(serveCmd)
+	sequenceCmd.AddCommand(apiCmd)
+	sequenceCmd.AddCommand(lintCmd)
+	sequenceCmd.AddCommand(testCmd)
+	sequenceCmd.AddCommand(compareCmd)
 }
 
 func profile() {
@@ -340,7 +618,7 @@ func profile() {
 	}
 
 	sigchan := make(chan os.Signal, 1)
-	signal.Notify(sigchan, os.Interrupt, os.Kill)
+	signal.Notify(sigchan, os.Interrupt, os.Kill, syscall.SIGTERM)
 	go func() {
 		select {
 		case sig := <-sigchan:
@@ -351,6 +629,10 @@ func profile() {
 
 		}
 
+		for _, hook := range exitHooks {
+			hook()
+		}
+
 		if f != nil {
 			glog.Errorf("Stopping profile")
 			pprof.StopCPUProfile()
@@ -358,79 +640,97 @@ func profile() {
 		}
 
 		close(done)
-		os.Exit(0)
+		os.Exit(exitStatus)
 	}()
 }
 
 func scan(cmd *cobra.Command, args []string) {
+	scanner := buildScanner()
 	seq := make(sequence.Sequence, 0, 20)
-	seq, err := sequence.DefaultScanner.Tokenize(inmsg, seq)
-	if err != nil {
-		log.Fatal(err)
+
+	if inmsg != "" {
+		seq, mformat, err := tokenize(scanner, inmsg, seq)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if format == "auto" {
+			fmt.Printf("# format: %s\n", mformat)
+		}
+
+		fmt.Println(seq.PrintTokens())
+		return
 	}
 
-	fmt.Println(seq.PrintTokens())
+	// Without a message, tokenize every line of the input
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	lineSource(infile)(func(line string) {
+		seq = seq[:0]
+		seq, mformat, err := tokenize(scanner, line, seq)
+		if err != nil {
+			log.Printf("Error (%s) scanning: %s", err, line)
+			return
+		} else if len(seq) == 0 {
+			return
+		}
+
+		if format == "auto" {
+			output(ofile, "%s\n# format: %s\n%s\n\n", line, mformat, seq.PrintTokens())
+		} else {
+			output(ofile, "%s\n%s\n\n", line, seq.PrintTokens())
+		}
+	})
 }
 
 func analyze(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
-	}
-
 	profile()
 
 	parser := buildParser()
-	analyzer := sequence.NewAnalyzer()
+	analyzer := buildAnalyzer()
+	scanner := buildScanner()
+	eachLine := lineSource(infile)
 
-	// Open input file
-	iscan, ifile := openFile(infile)
-	defer ifile.Close()
+	if seed {
+		seedAnalyzer(analyzer, parser)
+	}
 
 	seq := make(sequence.Sequence, 0, 20)
 
 	// For all the log messages, if we can't parse it, then let's add it to the
 	// analyzer for pattern analysis
-	for iscan.Scan() {
-		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
-
+	eachLine(func(line string) {
 		seq = seq[:0]
-		seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+		seq, err := scanner.Tokenize(line, seq)
 		if err != nil {
 			log.Fatal(err)
+		} else if len(seq) == 0 {
+			return
 		}
 
 		if _, err := parser.Parse(seq); err != nil {
 			analyzer.Add(seq)
 		}
-	}
+	})
 
-	ifile.Close()
 	analyzer.Finalize()
 
-	iscan, ifile = openFile(infile)
-	defer ifile.Close()
-
 	pmap := make(map[string]map[string]string)
 	amap := make(map[string]map[string]string)
 	n := 0
 
 	// Now that we have built the analyzer, let's go through each log message again
 	// to determine the unique patterns
-	for iscan.Scan() {
-		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
-		n++
-
+	eachLine(func(line string) {
 		seq = seq[:0]
-		seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+		seq, err := scanner.Tokenize(line, seq)
 		if err != nil {
 			log.Fatal(err)
+		} else if len(seq) == 0 {
+			return
 		}
+		n++
 
 		pseq, err := parser.Parse(seq)
 		if err == nil {
@@ -453,38 +753,36 @@ func analyze(cmd *cobra.Command, args []string) {
 				amap[pat][sig] = line
 			}
 		}
-	}
+	})
 
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
 
 	for pat, lines := range pmap {
-		fmt.Fprintf(ofile, "%s\n", pat)
+		output(ofile, "%s\n", pat)
 		for _, line := range lines {
-			fmt.Fprintf(ofile, "# %s\n", line)
+			output(ofile, "# %s\n", line)
 		}
-		fmt.Fprintln(ofile)
+		output(ofile, "\n")
 	}
 
 	for pat, lines := range amap {
-		fmt.Fprintf(ofile, "%s\n", pat)
+		output(ofile, "%s\n", pat)
 		for _, line := range lines {
-			fmt.Fprintf(ofile, "# %s\n", line)
+			output(ofile, "# %s\n", line)
 		}
-		fmt.Fprintln(ofile)
+		output(ofile, "\n")
 	}
 
 	log.Printf("Analyzed %d messages, found %d unique patterns, %d are new.", n, len(pmap)+len(amap), len(amap))
 }
 
 func parse(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
-	}
-
 	profile()
 
-	parser := buildParser()
+	scanner := buildScanner()
+	parsers := buildFormatParsers(scanner)
+	outschema := buildSchema()
 	seq := make(sequence.Sequence, 0, 20)
 
 	iscan, ifile := openFile(infile)
@@ -493,39 +791,93 @@ func parse(cmd *cobra.Command, args []string) {
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
 
+	if stats != "" && stats != "text" && stats != "json" {
+		log.Fatalf("Unknown stats format %q, must be text or json", stats)
+	}
+
+	pstats := sequence.NewParseStats()
+	learners := newLearners()
+
 	n := 0
 	now := time.Now()
 
 	for iscan.Scan() {
 		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
+		if skipLine(line) {
 			continue
 		}
-		n++
 
 		seq = seq[:0]
-		seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+		seq, mformat, err := tokenize(scanner, line, seq)
 		if err != nil {
 			log.Fatal(err)
+		} else if len(seq) == 0 {
+			continue
 		}
+		n++
 
-		pseq, err := parser.Parse(seq)
+		pseq, id, err := parsers[mformat].ParsePattern(seq)
 		if err != nil {
+			pstats.Unmatched(seq, line)
 			log.Printf("Error (%s) parsing: %s", err, line)
+
+			if learn {
+				learners.add(parsers[mformat], seq, line)
+			}
+
+			continue
+		}
+
+		pstats.Matched(id)
+
+		if outschema != nil {
+			meta := map[string]string{"message": line, "pattern": pseq.String(), "pattern_id": id}
+			if format == "auto" {
+				meta["format"] = mformat
+			}
+
+			doc, err := json.Marshal(outschema.Document(sequence.Decompose(pseq), meta))
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			output(ofile, "%s\n", doc)
+		} else if format == "auto" {
+			output(ofile, "%s\n# format: %s\n%s\n\n", line, mformat, sequence.Decompose(pseq).PrintTokens())
 		} else {
-			fmt.Fprintf(ofile, "%s\n%s\n\n", line, pseq.PrintTokens())
+			output(ofile, "%s\n%s\n\n", line, sequence.Decompose(pseq).PrintTokens())
 		}
 	}
 
+	if err := iscan.Err(); err != nil {
+		log.Fatal(err)
+	}
+
 	since := time.Since(now)
 	log.Printf("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)))
+
+	if learn {
+		learners.write()
+	}
+
+	report := buildReport(pstats, parsers)
+	if stats != "" {
+		writeReport(report)
+	}
+
+	if report.Coverage < minCover {
+		log.Printf("Coverage %.2f%% is below the minimum of %.2f%%", report.Coverage, minCover)
+		exitStatus = 1
+	}
+
 	close(quit)
 	<-done
 }
 
 func benchScan(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
+	scanner := buildScanner()
+	if workers > 1 && format != "general" && format != "auto" {
+		log.Fatalf("Multiple workers are not supported for the %s format", format)
 	}
 
 	iscan, ifile := openFile(infile)
@@ -537,7 +889,7 @@ func benchScan(cmd *cobra.Command, args []string) {
 
 	for iscan.Scan() {
 		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
+		if skipLine(line) {
 			continue
 		}
 
@@ -545,6 +897,10 @@ func benchScan(cmd *cobra.Command, args []string) {
 		lines = append(lines, line)
 	}
 
+	if err := iscan.Err(); err != nil {
+		log.Fatal(err)
+	}
+
 	profile()
 
 	now := time.Now()
@@ -552,7 +908,7 @@ func benchScan(cmd *cobra.Command, args []string) {
 	if workers == 1 {
 		for _, line := range lines {
 			seq = seq[:0]
-			sequence.DefaultScanner.Tokenize(line, seq)
+			scanner.Tokenize(line, seq)
 		}
 	} else {
 		var wg sync.WaitGroup
@@ -564,7 +920,7 @@ func benchScan(cmd *cobra.Command, args []string) {
 				defer wg.Done()
 				for line := range msgpipe {
 					seq = seq[:0]
-					sequence.DefaultScanner.Tokenize(line, seq)
+					scanner.Tokenize(line, seq)
 				}
 			}()
 		}
@@ -584,11 +940,11 @@ func benchScan(cmd *cobra.Command, args []string) {
 }
 
 func benchParse(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
-	}
-
 	parser := buildParser()
+	scanner := buildScanner()
+	if workers > 1 && format != "general" && format != "auto" {
+		log.Fatalf("Multiple workers are not supported for the %s format", format)
+	}
 
 	iscan, ifile := openFile(infile)
 	defer ifile.Close()
@@ -599,7 +955,7 @@ func benchParse(cmd *cobra.Command, args []string) {
 
 	for iscan.Scan() {
 		line := iscan.Text()
-		if len(line) == 0 || line[0] == '#' {
+		if skipLine(line) {
 			continue
 		}
 
@@ -608,6 +964,10 @@ func benchParse(cmd *cobra.Command, args []string) {
 		totalSize += len(line)
 	}
 
+	if err := iscan.Err(); err != nil {
+		log.Fatal(err)
+	}
+
 	profile()
 
 	now := time.Now()
@@ -616,7 +976,7 @@ func benchParse(cmd *cobra.Command, args []string) {
 		seq := make(sequence.Sequence, 0, 20)
 		for _, line := range lines {
 			seq = seq[:0]
-			seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+			seq, err := scanner.Tokenize(line, seq)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -633,7 +993,7 @@ func benchParse(cmd *cobra.Command, args []string) {
 				seq := make(sequence.Sequence, 0, 20)
 				for line := range msgpipe {
 					seq = seq[:0]
-					seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+					seq, err := scanner.Tokenize(line, seq)
 					if err != nil {
 						log.Fatal(err)
 					}
@@ -657,10 +1017,7 @@ func benchParse(cmd *cobra.Command, args []string) {
 }
 
 func buildParser() *sequence.Parser {
-	parser := sequence.NewParser()
-
 	var files []string
-	seq := make(sequence.Sequence, 0, 20)
 
 	if patdir != "" {
 		files = getDirOfFiles(patdir)
@@ -670,36 +1027,218 @@ func buildParser() *sequence.Parser {
 		files = append(files, patfile)
 	}
 
+	return buildParserFromFiles(files)
+}
+
+// buildFormatParsers returns the parser to use for each of the message formats
+// the scanner produces. Patterns in a subdirectory of the pattern directory that's
+// named after a format, e.g., patterns/json, only apply to messages of that format,
+// in addition to the patterns in the pattern directory itself.
+func buildFormatParsers(scanner sequence.Scanner) map[string]*sequence.Parser {
+	parser := buildParser()
+	parsers := map[string]*sequence.Parser{format: parser}
+
+	ms, ok := scanner.(*sequence.MultiScanner)
+	if !ok {
+		return parsers
+	}
+
+	for _, name := range ms.Formats() {
+		parsers[name] = parser
+
+		if patdir == "" {
+			continue
+		}
+
+		if fi, err := os.Stat(patdir + "/" + name); err == nil && fi.IsDir() {
+			var files []string
+
+			files = append(files, getDirOfFiles(patdir)...)
+			files = append(files, getDirOfFiles(patdir+"/"+name)...)
+
+			if patfile != "" {
+				files = append(files, patfile)
+			}
+
+			parsers[name] = buildParserFromFiles(files)
+		}
+	}
+
+	return parsers
+}
+
+func buildParserFromFiles(files []string) *sequence.Parser {
+	parser := sequence.NewParser()
+	seq := make(sequence.Sequence, 0, 20)
+
 	for _, file := range files {
 		// Open pattern file
-		pscan, pfile := openFile(file)
+		pfile, err := os.Open(file)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		for pscan.Scan() {
-			line := pscan.Text()
-			if len(line) == 0 || line[0] == '#' {
-				continue
-			}
+		defs, err := sequence.ReadPatterns(pfile, file)
+		pfile.Close()
+
+		if err != nil {
+			log.Fatal(err)
+		}
 
+		for _, def := range defs {
 			seq = seq[:0]
-			seq, err := sequence.DefaultScanner.Tokenize(line, seq)
+			seq, err := sequence.DefaultScanner.Tokenize(def.Pattern, seq)
 			if err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s:%d: %s", def.File, def.Line, err)
 			}
 
 			if err := parser.Add(seq); err != nil {
-				log.Fatal(err)
+				log.Fatalf("%s:%d: %s", def.File, def.Line, err)
 			}
-		}
 
-		pfile.Close()
+			if id := sequence.PatternID(sequence.AsPattern(seq)); patternSources[id] == "" {
+				patternSources[id] = fmt.Sprintf("%s:%d", def.File, def.Line)
+			}
+		}
 	}
 
 	return parser
 }
 
+// buildAnalyzer returns the analyzer of the --engine, with the options from the
+// flags of analyze.
+func buildAnalyzer() sequence.PatternAnalyzer {
+	switch engine {
+	case "tree":
+		opts := sequence.AnalyzerOptions{
+			MinValues:    minValues,
+			MinSupport:   minSupport,
+			MinRepeat:    minRepeat,
+			RestBranches: restBranch,
+			Align:        align,
+		}
+
+		for _, lit := range strings.Split(protected, ",") {
+			if lit = strings.TrimSpace(lit); lit != "" {
+				opts.Protected = append(opts.Protected, lit)
+			}
+		}
+
+		return sequence.NewAnalyzer(opts)
+
+	case "drain":
+		return sequence.NewDrainAnalyzer(sequence.DrainOptions{Depth: depth, Threshold: similarity, MaxChildren: maxKids})
+	}
+
+	log.Fatalf("Unknown engine %q, must be tree or drain", engine)
+	return nil
+}
+
+// seedAnalyzer seeds the analyzer with the patterns of the parser, so the new
+// patterns are consistent with them. Only the tree engine can be seeded.
+func seedAnalyzer(analyzer sequence.PatternAnalyzer, parser *sequence.Parser) {
+	atree, ok := analyzer.(*sequence.Analyzer)
+	if !ok {
+		return
+	}
+
+	for _, id := range parser.Patterns() {
+		seq, err := parser.Pattern(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := atree.Seed(seq); err != nil {
+			log.Printf("Error seeding the analyzer with %s: %s", seq, err)
+		}
+	}
+}
+
+// buildSchema returns the output schema selected, after loading the user's schema
+// file, or nil if no schema is selected
+func buildSchema() *sequence.Schema {
+	if schemafile != "" {
+		data, err := ioutil.ReadFile(schemafile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := sequence.LoadSchemas(string(data)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if schema == "" {
+		return nil
+	}
+
+	s, ok := sequence.Schemas[schema]
+	if !ok {
+		log.Fatalf("Invalid schema %q", schema)
+	}
+
+	return s
+}
+
+func buildScanner() sequence.Scanner {
+	var cols []string
+
+	if columns != "" {
+		cols = strings.Split(columns, ",")
+	}
+
+	switch format {
+	case "general":
+		return sequence.DefaultScanner
+
+	case "auto":
+		return sequence.NewMultiScanner()
+
+	case "w3c":
+		scanner := sequence.NewW3CScanner()
+		scanner.SetColumns(cols)
+		return scanner
+
+	case "csv":
+		return sequence.NewCSVScanner(cols, ',')
+
+	case "tsv":
+		return sequence.NewCSVScanner(cols, '\t')
+	}
+
+	log.Fatalf("Invalid format %q", format)
+	return nil
+}
+
+// tokenize returns the tokens for the line, as well as the format of the line. The
+// format is detected for each line if the format is auto.
+func tokenize(scanner sequence.Scanner, line string, seq sequence.Sequence) (sequence.Sequence, string, error) {
+	if ms, ok := scanner.(*sequence.MultiScanner); ok {
+		return ms.TokenizeFormat(line, seq)
+	}
+
+	seq, err := scanner.Tokenize(line, seq)
+	return seq, format, err
+}
+
+// skipLine returns true if the line should not be tokenized. Lines that start
+// with # are comments, except for the w3c, csv and tsv formats, where they are
+// directives that the scanner needs to see.
+func skipLine(line string) bool {
+	return len(line) == 0 || (line[0] == '#' && (format == "general" || format == "auto"))
+}
+
+// openFile returns a scanner for the lines of the file. If the file name is empty
+// or "-", the lines are read from stdin.
 func openFile(fname string) (*bufio.Scanner, *os.File) {
 	var s *bufio.Scanner
 
+	if fname == "" || fname == "-" {
+		s = bufio.NewScanner(os.Stdin)
+		s.Buffer(nil, maxLineSize)
+		return s, os.Stdin
+	}
+
 	f, err := os.Open(fname)
 	if err != nil {
 		log.Fatal(err)
@@ -716,9 +1255,52 @@ func openFile(fname string) (*bufio.Scanner, *os.File) {
 		s = bufio.NewScanner(f)
 	}
 
+	s.Buffer(nil, maxLineSize)
+
 	return s, f
 }
 
+// lineSource returns a function that calls fn for each line of the input file
+// that's not skipped. The returned function can be called more than once, each
+// time going through all the lines. Files are read again for each call, while
+// stdin is read only once, and its lines are kept in memory.
+func lineSource(fname string) func(fn func(line string)) {
+	eachLine := func(fn func(line string)) {
+		iscan, ifile := openFile(fname)
+		defer ifile.Close()
+
+		for iscan.Scan() {
+			if line := iscan.Text(); !skipLine(line) {
+				fn(line)
+			}
+		}
+
+		if err := iscan.Err(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if fname != "" && fname != "-" {
+		return eachLine
+	}
+
+	var lines []string
+	read := false
+
+	return func(fn func(line string)) {
+		if !read {
+			eachLine(func(line string) {
+				lines = append(lines, line)
+			})
+			read = true
+		}
+
+		for _, line := range lines {
+			fn(line)
+		}
+	}
+}
+
 func getDirOfFiles(path string) []string {
 	filenames := make([]string, 0, 10)
 
@@ -728,7 +1310,9 @@ func getDirOfFiles(path string) []string {
 	}
 
 	for _, f := range files {
-		filenames = append(filenames, path+"/"+f.Name())
+		if !f.IsDir() {
+			filenames = append(filenames, path+"/"+f.Name())
+		}
 	}
 
 	return filenames
@@ -740,8 +1324,8 @@ func openOutputFile(fname string) *os.File {
 		err   error
 	)
 
-	if fname == "" {
-		ofile = os.Stdin
+	if fname == "" || fname == "-" {
+		ofile = os.Stdout
 	} else {
 		// Open output file
 		ofile, err = os.OpenFile(fname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
@@ -753,6 +1337,22 @@ func openOutputFile(fname string) *os.File {
 	return ofile
 }
 
+// output writes to the output file. Writes are not buffered, so each message is
+// passed on as soon as it's processed. If the reader of the output has gone away,
+// e.g., "sequence parse | head", then the program exits quietly.
+func output(ofile *os.File, format string, a ...interface{}) {
+	if _, err := fmt.Fprintf(ofile, format, a...); err != nil {
+		if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EPIPE {
+			os.Exit(0)
+		}
+
+		log.Fatal(err)
+	}
+}
+
 func main() {
+	// Broken pipes are reported as write errors, and handled by output()
+	signal.Ignore(syscall.SIGPIPE)
+
 	sequenceCmd.Execute()
 }
@@ -0,0 +1,512 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+	"github.com/strace/sequence"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "serve will receive syslog messages over the network and output a list of parsed tokens for each of them",
+	}
+
+	udpAddr  string
+	tcpAddr  string
+	tlsAddr  string
+	certfile string
+	keyfile  string
+)
+
+const (
+	// maxMessageSize is the largest syslog message that will be accepted
+	maxMessageSize = 64 * 1024
+
+	// maxFrameDigits is the largest number of digits in the message length of an
+	// octet-counted frame
+	maxFrameDigits = 5
+)
+
+func init() {
+	serveCmd.Flags().StringVarP(&udpAddr, "udp", "u", "", "address to receive syslog over UDP, e.g., :514")
+	serveCmd.Flags().StringVarP(&tcpAddr, "tcp", "t", "", "address to receive syslog over TCP, e.g., :514")
+	serveCmd.Flags().StringVarP(&tlsAddr, "tls", "", "", "address to receive syslog over TLS, e.g., :6514, requires --cert and --key")
+	serveCmd.Flags().StringVarP(&certfile, "cert", "", "", "TLS certificate file")
+	serveCmd.Flags().StringVarP(&keyfile, "key", "", "", "TLS private key file")
+	serveCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, required")
+	serveCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
+	serveCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, appended to, if empty, to stdout")
+	serveCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of parsing workers")
+	serveCmd.Flags().StringVarP(&format, "format", "f", "general", "message format: general or auto")
+	serveCmd.Run = serve
+}
+
+// syslogMsg is a single message received from the network, and the address of the
+// host that sent it
+type syslogMsg struct {
+	data string
+	addr net.Addr
+}
+
+// syslogServer receives syslog messages from UDP, TCP and TLS listeners, and sends
+// them to a pool of workers for parsing. The results are written out by a single
+// writer so the output of different messages is never interleaved.
+type syslogServer struct {
+	scanner sequence.Scanner
+	parsers map[string]*sequence.Parser
+
+	msgpipe chan syslogMsg
+	results chan string
+
+	readers sync.WaitGroup
+	workers sync.WaitGroup
+	writer  sync.WaitGroup
+
+	mu        sync.Mutex
+	closing   bool
+	udpConns  []net.PacketConn
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+
+	received int64
+	parsed   int64
+}
+
+func serve(cmd *cobra.Command, args []string) {
+	if udpAddr == "" && tcpAddr == "" && tlsAddr == "" {
+		log.Fatal("At least one of --udp, --tcp or --tls is required")
+	}
+
+	if format != "general" && format != "auto" {
+		log.Fatalf("The %s format is not supported by serve", format)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	scanner := buildScanner()
+
+	srv := &syslogServer{
+		scanner: scanner,
+		parsers: buildFormatParsers(scanner),
+		msgpipe: make(chan syslogMsg, 10000),
+		results: make(chan string, 10000),
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	if udpAddr != "" {
+		conn, err := net.ListenPacket("udp", udpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		srv.udpConns = append(srv.udpConns, conn)
+		log.Printf("Receiving syslog over UDP on %s", conn.LocalAddr())
+	}
+
+	if tcpAddr != "" {
+		l, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		srv.listeners = append(srv.listeners, l)
+		log.Printf("Receiving syslog over TCP on %s", l.Addr())
+	}
+
+	if tlsAddr != "" {
+		if certfile == "" || keyfile == "" {
+			log.Fatal("Both --cert and --key are required for TLS")
+		}
+
+		cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		l, err := tls.Listen("tcp", tlsAddr, &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		srv.listeners = append(srv.listeners, l)
+		log.Printf("Receiving syslog over TLS on %s", l.Addr())
+	}
+
+	ofile := os.Stdout
+	if outfile != "" {
+		var err error
+
+		ofile, err = os.OpenFile(outfile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	srv.writer.Add(1)
+	go srv.write(ofile)
+
+	for i := 0; i < workers; i++ {
+		srv.workers.Add(1)
+		go srv.work()
+	}
+
+	for _, conn := range srv.udpConns {
+		srv.readers.Add(1)
+		go srv.readPackets(conn)
+	}
+
+	for _, l := range srv.listeners {
+		srv.readers.Add(1)
+		go srv.accept(l)
+	}
+
+	exitHooks = append(exitHooks, func() {
+		srv.stop()
+
+		if ofile != os.Stdout {
+			ofile.Close()
+		}
+	})
+
+	profile()
+
+	<-done
+}
+
+// stop closes all the listeners and connections, and waits for the messages that
+// have already been received to be parsed and written out.
+func (this *syslogServer) stop() {
+	this.mu.Lock()
+	this.closing = true
+
+	for _, conn := range this.udpConns {
+		conn.Close()
+	}
+
+	for _, l := range this.listeners {
+		l.Close()
+	}
+
+	for conn := range this.conns {
+		conn.Close()
+	}
+	this.mu.Unlock()
+
+	this.readers.Wait()
+	close(this.msgpipe)
+
+	this.workers.Wait()
+	close(this.results)
+
+	this.writer.Wait()
+
+	log.Printf("Received %d messages, parsed %d", atomic.LoadInt64(&this.received), atomic.LoadInt64(&this.parsed))
+}
+
+func (this *syslogServer) isClosing() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.closing
+}
+
+// readPackets reads syslog messages from a UDP socket, one message per datagram
+func (this *syslogServer) readPackets(conn net.PacketConn) {
+	defer this.readers.Done()
+
+	buf := make([]byte, maxMessageSize)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !this.isClosing() {
+				log.Printf("Error reading from %s: %s", conn.LocalAddr(), err)
+			}
+			return
+		}
+
+		this.msgpipe <- syslogMsg{string(buf[:n]), addr}
+	}
+}
+
+// accept accepts connections from a TCP or TLS listener, and starts a reader for
+// each of them
+func (this *syslogServer) accept(l net.Listener) {
+	defer this.readers.Done()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !this.isClosing() {
+				log.Printf("Error accepting from %s: %s", l.Addr(), err)
+			}
+			return
+		}
+
+		this.mu.Lock()
+		if this.closing {
+			this.mu.Unlock()
+			conn.Close()
+			return
+		}
+
+		this.conns[conn] = struct{}{}
+		this.readers.Add(1)
+		this.mu.Unlock()
+
+		go this.readStream(conn)
+	}
+}
+
+// readStream reads syslog messages from a TCP or TLS connection until the
+// connection is closed
+func (this *syslogServer) readStream(conn net.Conn) {
+	defer this.readers.Done()
+
+	defer func() {
+		this.mu.Lock()
+		delete(this.conns, conn)
+		this.mu.Unlock()
+
+		conn.Close()
+	}()
+
+	r := bufio.NewReaderSize(conn, maxMessageSize)
+
+	for {
+		msg, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF && !this.isClosing() {
+				log.Printf("Error reading from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if msg != "" {
+			this.msgpipe <- syslogMsg{msg, conn.RemoteAddr()}
+		}
+	}
+}
+
+// readFrame reads a single syslog message from a stream. Messages are framed
+// either by octet counting, i.e., "MSG-LEN SP SYSLOG-MSG", or by a trailing
+// newline, as described in RFC6587. The framing is detected for each message, and
+// either way, a message larger than maxMessageSize is an error.
+func readFrame(r *bufio.Reader) (string, error) {
+	if n, l := frameLength(r); l > 0 {
+		if n > maxMessageSize {
+			return "", fmt.Errorf("message length %d is larger than %d", n, maxMessageSize)
+		}
+
+		r.Discard(l)
+
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	}
+
+	// the line is read in slices of the buffer, so a client that never sends a
+	// newline can't make it grow without bound
+	var line []byte
+
+	for {
+		b, err := r.ReadSlice('\n')
+		if len(line)+len(b) > maxMessageSize {
+			return "", fmt.Errorf("message is larger than %d", maxMessageSize)
+		}
+
+		line = append(line, b...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return "", err
+		}
+
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// frameLength checks if the next message in the stream starts with an octet count,
+// and if so, returns the message length, and the length of the count including the
+// trailing space. Otherwise it returns 0, 0. The count must be followed by the
+// "<PRI>" of the message, so a newline framed message that starts with a number,
+// e.g., "15 Jan ...", isn't taken as octet counted.
+func frameLength(r *bufio.Reader) (int, int) {
+	for i := 1; i <= maxFrameDigits+1; i++ {
+		b, err := r.Peek(i)
+		if err != nil {
+			return 0, 0
+		}
+
+		c := b[i-1]
+
+		switch {
+		case c == ' ' && i > 1:
+			if b, err = r.Peek(i + 1); err != nil || b[i] != '<' {
+				return 0, 0
+			}
+
+			n, _ := strconv.Atoi(string(b[:i-1]))
+			return n, i
+
+		case c < '0' || c > '9' || (i == 1 && c == '0'):
+			return 0, 0
+		}
+	}
+
+	return 0, 0
+}
+
+// work parses the messages from the message pipe, and sends the results to the
+// writer
+func (this *syslogServer) work() {
+	defer this.workers.Done()
+
+	seq := make(sequence.Sequence, 0, 20)
+
+	for msg := range this.msgpipe {
+		atomic.AddInt64(&this.received, 1)
+
+		pri, line := splitPriority(strings.TrimRight(msg.data, "\r\n\x00"))
+		if line == "" {
+			continue
+		}
+
+		seq = seq[:0]
+		seq, mformat, err := tokenize(this.scanner, line, seq)
+		if err != nil {
+			log.Printf("Error (%s) scanning: %s", err, line)
+			continue
+		} else if len(seq) == 0 {
+			continue
+		}
+
+		pseq, err := this.parsers[mformat].Parse(seq)
+		if err != nil {
+			log.Printf("Error (%s) parsing: %s", err, line)
+			continue
+		}
+
+		pseq = sequence.Decompose(pseq)
+
+		if pri != "" && !hasField(pseq, sequence.FieldPriority) {
+			pseq = append(pseq, sequence.Token{Field: sequence.FieldPriority, Type: sequence.TokenInteger, Value: pri})
+		}
+
+		// The sender is the best guess we have for the host that generated the
+		// message, if the header doesn't tell us
+		if ip := senderIPv4(msg.addr); ip != "" && !hasField(pseq, sequence.FieldAppIPv4) {
+			pseq = append(pseq, sequence.Token{Field: sequence.FieldAppIPv4, Type: sequence.TokenIPv4, Value: ip})
+		}
+
+		atomic.AddInt64(&this.parsed, 1)
+
+		if format == "auto" {
+			this.results <- fmt.Sprintf("%s\n# format: %s\n%s\n\n", line, mformat, pseq.PrintTokens())
+		} else {
+			this.results <- fmt.Sprintf("%s\n%s\n\n", line, pseq.PrintTokens())
+		}
+	}
+}
+
+// write writes the results to the output file, flushing whenever there are no
+// more results waiting
+func (this *syslogServer) write(ofile *os.File) {
+	defer this.writer.Done()
+
+	w := bufio.NewWriter(ofile)
+
+	for res := range this.results {
+		w.WriteString(res)
+
+		if len(this.results) == 0 {
+			if err := w.Flush(); err != nil {
+				log.Printf("Error writing results: %s", err)
+			}
+		}
+	}
+
+	w.Flush()
+}
+
+// splitPriority removes the "<PRI>" prefix from a syslog message, and returns the
+// priority and the rest of the message. If there's no prefix, the priority is empty.
+func splitPriority(msg string) (string, string) {
+	if len(msg) < 3 || msg[0] != '<' {
+		return "", msg
+	}
+
+	i := strings.IndexByte(msg, '>')
+	if i < 2 || i > 4 {
+		return "", msg
+	}
+
+	if _, err := strconv.Atoi(msg[1:i]); err != nil {
+		return "", msg
+	}
+
+	return msg[1:i], strings.TrimLeft(msg[i+1:], " ")
+}
+
+// senderIPv4 returns the IPv4 address of the sender, or an empty string if the
+// sender is not using IPv4
+func senderIPv4(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
+
+func hasField(seq sequence.Sequence, field sequence.FieldType) bool {
+	for _, tok := range seq {
+		if tok.Field == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameLength(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		n, l int
+	}{
+		{"23 <34>Oct 11 22:14:15 su", 23, 3},
+		{"105 <165>1 2003-10-11T22:14:15.003Z", 105, 4},
+		{"15 Jan 12 06:49:42 irc sshd[7034]: session closed", 0, 0},
+		{"<34>Oct 11 22:14:15 su", 0, 0},
+		{"023 <34>Oct 11 22:14:15 su", 0, 0},
+		{"123456 <34>Oct 11 22:14:15 su", 0, 0},
+		{"23", 0, 0},
+		{"23 ", 0, 0},
+		{"", 0, 0},
+	} {
+		n, l := frameLength(bufio.NewReader(strings.NewReader(tc.data)))
+		require.Equal(t, tc.n, n, tc.data)
+		require.Equal(t, tc.l, l, tc.data)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		msgs []string
+	}{
+		{
+			"<34>Oct 11 22:14:15 su: one\n<34>Oct 11 22:14:16 su: two\r\n",
+			[]string{"<34>Oct 11 22:14:15 su: one", "<34>Oct 11 22:14:16 su: two"},
+		},
+		{
+			"27 <34>Oct 11 22:14:15 su: one27 <34>Oct 11 22:14:16 su: two",
+			[]string{"<34>Oct 11 22:14:15 su: one", "<34>Oct 11 22:14:16 su: two"},
+		},
+		{
+			"28 <34>Oct 11 22:14:15 su: a\nb\n<34>Oct 11 22:14:16 su: two",
+			[]string{"<34>Oct 11 22:14:15 su: a\nb", "<34>Oct 11 22:14:16 su: two"},
+		},
+		{
+			"15 Jan 12 06:49:42 irc sshd[7034]: session closed\n",
+			[]string{"15 Jan 12 06:49:42 irc sshd[7034]: session closed"},
+		},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.data))
+
+		for _, msg := range tc.msgs {
+			got, err := readFrame(r)
+			require.NoError(t, err, tc.data)
+			require.Equal(t, msg, got, tc.data)
+		}
+
+		_, err := readFrame(r)
+		require.Equal(t, io.EOF, err, tc.data)
+	}
+
+	_, err := readFrame(bufio.NewReader(strings.NewReader("99999 <34>Oct 11 22:14:15 su")))
+	require.Error(t, err)
+
+	// a newline framed message can't be larger than maxMessageSize either
+	long := "<34>Oct 11 22:14:15 su: " + strings.Repeat("a", maxMessageSize)
+
+	_, err = readFrame(bufio.NewReader(strings.NewReader(long + "\n")))
+	require.Error(t, err)
+
+	got, err := readFrame(bufio.NewReader(strings.NewReader(long[:maxMessageSize-1] + "\n")))
+	require.NoError(t, err)
+	require.Equal(t, long[:maxMessageSize-1], got)
+}
+
+func TestSplitPriority(t *testing.T) {
+	for _, tc := range []struct {
+		msg, pri, rest string
+	}{
+		{"<34>Oct 11 22:14:15 su", "34", "Oct 11 22:14:15 su"},
+		{"<165> 1 2003-10-11T22:14:15.003Z", "165", "1 2003-10-11T22:14:15.003Z"},
+		{"<0>boot", "0", "boot"},
+		{"Oct 11 22:14:15 su", "", "Oct 11 22:14:15 su"},
+		{"<>Oct 11", "", "<>Oct 11"},
+		{"<1234>Oct 11", "", "<1234>Oct 11"},
+		{"<ab>Oct 11", "", "<ab>Oct 11"},
+		{"<34", "", "<34"},
+	} {
+		pri, rest := splitPriority(tc.msg)
+		require.Equal(t, tc.pri, pri, tc.msg)
+		require.Equal(t, tc.rest, rest, tc.msg)
+	}
+}
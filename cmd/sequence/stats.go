@@ -0,0 +1,119 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/strace/sequence"
+)
+
+// buildReport returns the summary of the stats, over the patterns of all the
+// format parsers, with where each of the patterns is defined.
+func buildReport(pstats *sequence.ParseStats, parsers map[string]*sequence.Parser) sequence.ParseReport {
+	var list []*sequence.Parser
+
+	seen := make(map[*sequence.Parser]bool)
+
+	// the parser of the --format comes first, so its patterns are listed before the
+	// ones of the format subdirectories
+	for _, p := range append([]*sequence.Parser{parsers[format]}, sortedParsers(parsers)...) {
+		if p != nil && !seen[p] {
+			seen[p] = true
+			list = append(list, p)
+		}
+	}
+
+	report := pstats.Report(list...)
+
+	for i := range report.Patterns {
+		report.Patterns[i].Source = patternSources[report.Patterns[i].ID]
+	}
+
+	return report
+}
+
+// sortedParsers returns the parsers in the order of their format names.
+func sortedParsers(parsers map[string]*sequence.Parser) []*sequence.Parser {
+	var names []string
+	for name := range parsers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var list []*sequence.Parser
+	for _, name := range names {
+		list = append(list, parsers[name])
+	}
+
+	return list
+}
+
+// writeReport writes the report, in the --stats format, to the --statsfile, or
+// stderr if there's none.
+func writeReport(report sequence.ParseReport) {
+	var w io.Writer = os.Stderr
+
+	if statsfile != "" {
+		f, err := os.Create(statsfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if stats == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	fmt.Fprintf(w, "Coverage: %.2f%%, %d of %d messages matched\n", report.Coverage, report.Matched, report.Messages)
+
+	var unused []sequence.PatternHits
+
+	fmt.Fprintf(w, "\nHits per pattern:\n")
+	for _, p := range report.Patterns {
+		if p.Hits == 0 {
+			unused = append(unused, p)
+			continue
+		}
+
+		fmt.Fprintf(w, "%10d  %s  %s\n", p.Hits, p.Source, p.Pattern)
+	}
+
+	fmt.Fprintf(w, "\nPatterns with no hits: %d\n", len(unused))
+	for _, p := range unused {
+		fmt.Fprintf(w, "  %s  %s\n", p.Source, p.Pattern)
+	}
+
+	fmt.Fprintf(w, "\nUnmatched messages by signature: %d\n", report.Messages-report.Matched)
+	for _, sc := range report.Unmatched {
+		fmt.Fprintf(w, "%10d  %q\n            e.g. %s\n", sc.Count, sc.Signature, sc.Example)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/strace/sequence"
+)
+
+var (
+	testCmd = &cobra.Command{
+		Use:   "test [pattern files]",
+		Short: "test will parse the examples under each pattern and check they match the pattern and the expected field values",
+	}
+
+	verbose bool
+)
+
+func init() {
+	testCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file")
+	testCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
+	testCmd.Flags().StringVarP(&format, "format", "f", "general", "message format of the examples: general, auto, w3c, csv or tsv")
+	testCmd.Flags().StringVarP(&columns, "columns", "", "", "comma separated list of columns for w3c, csv or tsv formats")
+	testCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "report the examples that pass as well")
+	testCmd.Run = test
+}
+
+// test reads the pattern files, and checks the examples under each pattern with
+// sequence.CheckExamples. It exits with status 1 if any of the examples fail.
+func test(cmd *cobra.Command, args []string) {
+	var files []string
+
+	if patdir != "" {
+		files = getDirOfFiles(patdir)
+	}
+
+	if patfile != "" {
+		files = append(files, patfile)
+	}
+
+	files = append(files, args...)
+
+	if len(files) == 0 {
+		log.Fatal("At least one of --patdir, --patfile or a pattern file is required")
+	}
+
+	var defs []sequence.PatternDef
+
+	for _, file := range files {
+		pfile, err := os.Open(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		d, err := sequence.ReadPatterns(pfile, file)
+		pfile.Close()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defs = append(defs, d...)
+	}
+
+	var (
+		passed, failed, untested int
+		results                  = sequence.CheckExamples(defs, buildScanner())
+	)
+
+	for _, def := range defs {
+		if len(def.Examples) == 0 {
+			untested++
+		}
+	}
+
+	for _, res := range results {
+		if res.Err == nil {
+			passed++
+
+			if verbose {
+				fmt.Printf("PASS %s:%d: %s\n", res.File, res.Line, res.Example)
+			}
+
+			continue
+		}
+
+		failed++
+		fmt.Printf("FAIL %s:%d: %s\n     %s\n", res.File, res.Line, res.Example, res.Err)
+	}
+
+	log.Printf("Checked %d examples of %d patterns, %d passed, %d failed, %d patterns have no examples", len(results), len(defs)-untested, passed, failed, untested)
+
+	if failed > 0 {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+
+	fmt.Println("PASS")
+}
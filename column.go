@@ -0,0 +1,275 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// W3CFieldMap maps the W3C extended log format field identifiers, as used by IIS,
+// Bluecoat and many other appliances, to their semantic field types. Columns that
+// are not in the map, and that are not a field name themselves (e.g., srcipv4),
+// are returned with FieldUnknown.
+var W3CFieldMap = map[string]FieldType{
+	"date":             FieldMsgTime,
+	"time":             FieldMsgTime,
+	"s-sitename":       FieldAppName,
+	"s-computername":   FieldAppHost,
+	"s-ip":             FieldDstIPv4,
+	"s-port":           FieldDstPort,
+	"s-action":         FieldAction,
+	"cs-method":        FieldMethod,
+	"cs-uri-stem":      FieldObject,
+	"cs-username":      FieldSrcUser,
+	"cs-host":          FieldDstHost,
+	"cs-protocol":      FieldProtocol,
+	"cs-bytes":         FieldBytesRecv,
+	"c-ip":             FieldSrcIPv4,
+	"c-port":           FieldSrcPort,
+	"sc-status":        FieldStatus,
+	"sc-bytes":         FieldBytesSent,
+	"sc-filter-result": FieldAction,
+	"time-taken":       FieldDuration,
+}
+
+// W3CDurationUnits maps the W3C extended log format field identifiers of the
+// durations to their units, since they are written as plain numbers, e.g., the
+// time-taken of IIS is in milliseconds.
+var W3CDurationUnits = map[string]string{
+	"time-taken": "ms",
+}
+
+// ColumnScanner is a header-aware lexical analyzer for logs where every line is a
+// list of delimited columns, such as W3C extended logs (IIS, Bluecoat), CSV and TSV
+// files. The column order is defined by the "#Fields:" directive in the log, or by
+// a list of columns supplied by the user. Each column becomes a single token, with
+// the field type determined by the column name.
+//
+// The "#Fields:" directive can appear multiple times in the same file, and each
+// time it does, the columns for the lines that follow are replaced. Because of
+// this, a ColumnScanner keeps state between messages and should not be shared
+// between different log streams, or used concurrently.
+type ColumnScanner struct {
+	// Delimiter is the rune that separates the columns. If it's a space, then
+	// successive spaces are treated as a single delimiter.
+	Delimiter rune
+
+	// Mapping maps column names to field types. Column names are matched case
+	// insensitively.
+	Mapping map[string]FieldType
+
+	// DurationUnits maps column names to the units of their numbers, e.g., ms,
+	// which are added to the values, so they are returned as durations, and are
+	// not taken as seconds. Column names are matched case insensitively.
+	DurationUnits map[string]string
+
+	columns []string
+	fields  []FieldType
+}
+
+var _ Scanner = (*ColumnScanner)(nil)
+
+// NewW3CScanner returns a ColumnScanner for W3C extended log files. The columns
+// are defined by the "#Fields:" directive in the log.
+func NewW3CScanner() *ColumnScanner {
+	return &ColumnScanner{
+		Delimiter:     ' ',
+		Mapping:       W3CFieldMap,
+		DurationUnits: W3CDurationUnits,
+	}
+}
+
+// NewCSVScanner returns a ColumnScanner for delimited files, such as CSV (',') or
+// TSV ('\t'), with the list of columns supplied. Each of the columns can be a W3C
+// field identifier, such as c-ip, or a field name, such as srcipv4.
+func NewCSVScanner(columns []string, delim rune) *ColumnScanner {
+	this := &ColumnScanner{
+		Delimiter:     delim,
+		Mapping:       W3CFieldMap,
+		DurationUnits: W3CDurationUnits,
+	}
+
+	this.SetColumns(columns)
+
+	return this
+}
+
+// SetColumns replaces the current list of columns.
+func (this *ColumnScanner) SetColumns(columns []string) {
+	this.columns = append(this.columns[:0], columns...)
+	this.fields = this.fields[:0]
+
+	for _, c := range columns {
+		this.fields = append(this.fields, this.columnField(c))
+	}
+}
+
+// Columns returns the current list of columns.
+func (this *ColumnScanner) Columns() []string {
+	return this.columns
+}
+
+// Tokenize returns a Sequence, or a list of tokens, for the data string supplied.
+// Each column in the data string is returned as a single token. If the W3C "date"
+// column is immediately followed by the "time" column, they are combined into a
+// single %msgtime% token. The numbers in the columns with a duration unit are
+// returned as durations in that unit.
+//
+// Directive lines, i.e., lines that start with "#", are not tokenized. If it's
+// a "#Fields:" directive, the list of columns is replaced, and an empty Sequence
+// is returned.
+func (this *ColumnScanner) Tokenize(s string, seq Sequence) (Sequence, error) {
+	if len(s) > 0 && s[0] == '#' {
+		if strings.HasPrefix(s, "#Fields:") {
+			this.SetColumns(strings.Fields(s[len("#Fields:"):]))
+		}
+
+		return seq[:0], nil
+	}
+
+	cells, err := this.split(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(this.columns) > 0 && len(cells) != len(this.columns) {
+		return nil, fmt.Errorf("sequence: expecting %d columns, found %d: %s", len(this.columns), len(cells), s)
+	}
+
+	for i := 0; i < len(cells); i++ {
+		tok := Token{Field: FieldUnknown, Type: cellType(cells[i]), Value: cells[i]}
+
+		if i < len(this.fields) {
+			tok.Field = this.fields[i]
+
+			// Fields that are strings take any value, e.g., a numeric status code
+			if tok.Field.TokenType() == TokenString && tok.Type != TokenLiteral {
+				tok.Type = TokenString
+			}
+
+			// e.g., the time-taken of IIS, 1593, is returned as 1593ms
+			if unit := this.DurationUnits[strings.ToLower(this.columns[i])]; unit != "" && (tok.Type == TokenInteger || tok.Type == TokenFloat) {
+				tok.Type = TokenDuration
+				tok.Value += unit
+			}
+
+			if i+1 < len(cells) && strings.EqualFold(this.columns[i], "date") && strings.EqualFold(this.columns[i+1], "time") {
+				tok.Type = TokenTime
+				tok.Value = cells[i] + " " + cells[i+1]
+				i++
+			}
+		}
+
+		seq = append(seq, tok)
+	}
+
+	return seq, nil
+}
+
+func (this *ColumnScanner) columnField(c string) FieldType {
+	c = strings.ToLower(c)
+
+	if f, ok := this.Mapping[c]; ok {
+		return f
+	}
+
+	return name2FieldType("%" + c + "%")
+}
+
+// split breaks the data string into columns. Columns can be quoted with double
+// quotes, in which case the delimiter can be part of the column, and two double
+// quotes in a row represent a single double quote.
+func (this *ColumnScanner) split(s string) ([]string, error) {
+	var (
+		cells []string
+		cell  []rune
+		quote bool
+		start = true // are we at the start of a cell?
+	)
+
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+
+		switch {
+		case quote:
+			if r == '"' {
+				if i+1 < len(rs) && rs[i+1] == '"' {
+					cell = append(cell, r)
+					i++
+				} else {
+					quote = false
+				}
+			} else {
+				cell = append(cell, r)
+			}
+
+		case r == '"' && start:
+			quote = true
+			start = false
+
+		case r == this.Delimiter:
+			if this.Delimiter == ' ' && start {
+				// successive spaces are a single delimiter
+				continue
+			}
+
+			cells = append(cells, string(cell))
+			cell = cell[:0]
+			start = true
+
+		default:
+			cell = append(cell, r)
+			start = false
+		}
+	}
+
+	if quote {
+		return nil, fmt.Errorf("sequence: unterminated quote: %s", s)
+	}
+
+	if !start || this.Delimiter != ' ' {
+		cells = append(cells, string(cell))
+	}
+
+	return cells, nil
+}
+
+// cellType determines the token type of a single column value. If the value is
+// not a single token, or it's a literal, then it's considered a string. W3C logs
+// use "-" to indicate an empty column, which is kept as a literal.
+func cellType(s string) TokenType {
+	if len(s) == 0 || s == "-" {
+		return TokenLiteral
+	}
+
+	msg := &message{data: s}
+	msg.reset()
+
+	l, t, err := msg.scanToken(s)
+	if err == nil && (t == TokenLiteral || l != len(s)) {
+		if lt := literalType(s); lt != TokenLiteral {
+			l, t = len(s), lt
+		}
+	}
+
+	if err != nil || l != len(s) || t == TokenLiteral || t == TokenUnknown {
+		return TokenString
+	}
+
+	return t
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	w3ctests = []struct {
+		data string
+		seq  Sequence
+	}{
+		{
+			"#Software: Microsoft Internet Information Services 6.0",
+			Sequence{},
+		},
+		{
+			"#Fields: date time s-ip cs-method cs-uri-stem s-port cs-username c-ip cs(User-Agent) sc-status time-taken",
+			Sequence{},
+		},
+		{
+			"2002-05-24 20:18:01 172.224.24.114 GET /Default.htm 80 - 3.87.237.22 Mozilla/4.0+(compatible;+MSIE+5.01) 200 1593",
+			Sequence{
+				Token{Field: FieldMsgTime, Type: TokenTime, Value: "2002-05-24 20:18:01"},
+				Token{Field: FieldDstIPv4, Type: TokenIPv4, Value: "172.224.24.114"},
+				Token{Field: FieldMethod, Type: TokenString, Value: "GET"},
+				Token{Field: FieldObject, Type: TokenString, Value: "/Default.htm"},
+				Token{Field: FieldDstPort, Type: TokenInteger, Value: "80"},
+				Token{Field: FieldSrcUser, Type: TokenLiteral, Value: "-"},
+				Token{Field: FieldSrcIPv4, Type: TokenIPv4, Value: "3.87.237.22"},
+				Token{Field: FieldUnknown, Type: TokenString, Value: "Mozilla/4.0+(compatible;+MSIE+5.01)"},
+				Token{Field: FieldStatus, Type: TokenString, Value: "200"},
+				Token{Field: FieldDuration, Type: TokenDuration, Value: "1593ms"},
+			},
+		},
+		{
+			"#Fields: c-ip cs-username s-action",
+			Sequence{},
+		},
+		{
+			"10.1.2.3 \"CORP\\alice smith\" TCP_DENIED",
+			Sequence{
+				Token{Field: FieldSrcIPv4, Type: TokenIPv4, Value: "10.1.2.3"},
+				Token{Field: FieldSrcUser, Type: TokenString, Value: "CORP\\alice smith"},
+				Token{Field: FieldAction, Type: TokenString, Value: "TCP_DENIED"},
+			},
+		},
+	}
+
+	csvtests = []struct {
+		data string
+		seq  Sequence
+	}{
+		{
+			"10.1.2.3,\"alice, \"\"the admin\"\"\",443,",
+			Sequence{
+				Token{Field: FieldSrcIPv4, Type: TokenIPv4, Value: "10.1.2.3"},
+				Token{Field: FieldSrcUser, Type: TokenString, Value: "alice, \"the admin\""},
+				Token{Field: FieldDstPort, Type: TokenInteger, Value: "443"},
+				Token{Field: FieldUnknown, Type: TokenLiteral, Value: ""},
+			},
+		},
+	}
+)
+
+func TestColumnScannerW3C(t *testing.T) {
+	scanner := NewW3CScanner()
+	seq := make(Sequence, 0, 20)
+
+	for _, tc := range w3ctests {
+		seq = seq[:0]
+		seq, err := scanner.Tokenize(tc.data, seq)
+		require.NoError(t, err)
+		require.Equal(t, tc.seq, seq, tc.data+"\n"+seq.String())
+	}
+
+	// the time-taken is in milliseconds
+	seq, err := scanner.Tokenize("#Fields: c-ip time-taken", seq[:0])
+	require.NoError(t, err)
+
+	seq, err = scanner.Tokenize("10.1.2.3 1593", seq)
+	require.NoError(t, err)
+
+	d, err := seq[1].Duration()
+	require.NoError(t, err)
+	require.Equal(t, 1593*time.Millisecond, d)
+
+	f, err := seq[1].Float()
+	require.NoError(t, err)
+	require.Equal(t, 1.593, f)
+}
+
+func TestColumnScannerCSV(t *testing.T) {
+	scanner := NewCSVScanner([]string{"srcipv4", "cs-username", "dstport", "comment"}, ',')
+	seq := make(Sequence, 0, 20)
+
+	for _, tc := range csvtests {
+		seq = seq[:0]
+		seq, err := scanner.Tokenize(tc.data, seq)
+		require.NoError(t, err)
+		require.Equal(t, tc.seq, seq, tc.data)
+	}
+
+	_, err := scanner.Tokenize("10.1.2.3,alice", seq[:0])
+	require.Error(t, err)
+}
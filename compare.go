@@ -0,0 +1,243 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChangeKind is how a message is parsed differently by the new set of patterns
+// in a Comparison.
+type ChangeKind int
+
+const (
+	// Unchanged is a message that's matched by the same pattern, or not matched,
+	// by both sets of patterns.
+	Unchanged ChangeKind = iota
+
+	// NewlyMatched is a message that's only matched by the new patterns.
+	NewlyMatched
+
+	// NewlyUnmatched is a message that's only matched by the old patterns.
+	NewlyUnmatched
+
+	// PatternChanged is a message that's matched by a different pattern, but
+	// with the same field values.
+	PatternChanged
+
+	// FieldsChanged is a message that's matched by both sets of patterns, with
+	// different field values.
+	FieldsChanged
+
+	changeKindsCount
+)
+
+var changeKindNames = [...]string{"unchanged", "matched", "unmatched", "pattern", "fields"}
+
+func (this ChangeKind) String() string {
+	if this < 0 || this >= changeKindsCount {
+		return "unknown"
+	}
+
+	return changeKindNames[this]
+}
+
+// ChangeKindFromString returns the ChangeKind with the name, as returned by
+// String, or -1 if there's none.
+func ChangeKindFromString(s string) ChangeKind {
+	for i, name := range changeKindNames {
+		if name == s {
+			return ChangeKind(i)
+		}
+	}
+
+	return -1
+}
+
+// Change is how a message is parsed by the old and new sets of patterns. The
+// patterns are empty if they don't match the message, and Fields describes the
+// field values that are different, for FieldsChanged.
+type Change struct {
+	Kind       ChangeKind `json:"-"`
+	Message    string     `json:"message"`
+	OldPattern string     `json:"old_pattern,omitempty"`
+	NewPattern string     `json:"new_pattern,omitempty"`
+	Fields     string     `json:"fields,omitempty"`
+}
+
+// Comparison runs messages through the parsers of an old and a new set of
+// patterns, and keeps count of the messages that are parsed differently, with
+// some of them as samples, so the impact of changing the patterns can be checked
+// before they are used. It's safe for concurrent use.
+type Comparison struct {
+	old, new *Parser
+
+	// samples is the most messages kept for each kind of change
+	samples int
+
+	mu       sync.Mutex
+	messages int
+	counts   [changeKindsCount]int
+	changes  [changeKindsCount][]Change
+}
+
+// CompareReport is the summary of a Comparison.
+type CompareReport struct {
+	Messages  int `json:"messages"`
+	Unchanged int `json:"unchanged"`
+
+	// Changes are the messages that are parsed differently, for each kind of
+	// change there are messages for
+	Changes []ChangeCount `json:"changes"`
+}
+
+// ChangeCount is the number of messages with the kind of change, and some of
+// them as the samples.
+type ChangeCount struct {
+	Kind    string   `json:"kind"`
+	Count   int      `json:"count"`
+	Samples []Change `json:"samples"`
+}
+
+// NewComparison returns a Comparison of the old and new parsers, that keeps up to
+// samples messages for each kind of change.
+func NewComparison(old, new *Parser, samples int) *Comparison {
+	return &Comparison{old: old, new: new, samples: samples}
+}
+
+// Compare parses the message sequence with both parsers, and returns how it's
+// parsed differently, if it is. Field values are compared after Decompose.
+func (this *Comparison) Compare(seq Sequence, msg string) Change {
+	change := Change{Message: msg}
+
+	oseq, oid, oerr := this.old.ParsePattern(seq)
+	nseq, nid, nerr := this.new.ParsePattern(seq)
+
+	if oerr == nil {
+		change.OldPattern = oseq.String()
+	}
+
+	if nerr == nil {
+		change.NewPattern = nseq.String()
+	}
+
+	switch {
+	case oerr != nil && nerr != nil:
+
+	case oerr != nil:
+		change.Kind = NewlyMatched
+
+	case nerr != nil:
+		change.Kind = NewlyUnmatched
+
+	default:
+		if change.Fields = diffFields(fieldValues(Decompose(oseq)), fieldValues(Decompose(nseq))); change.Fields != "" {
+			change.Kind = FieldsChanged
+		} else if oid != nid {
+			change.Kind = PatternChanged
+		}
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.messages++
+	this.counts[change.Kind]++
+
+	if change.Kind != Unchanged && len(this.changes[change.Kind]) < this.samples {
+		this.changes[change.Kind] = append(this.changes[change.Kind], change)
+	}
+
+	return change
+}
+
+// Count returns the number of messages compared so far with the kind of change.
+func (this *Comparison) Count(kind ChangeKind) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if kind < 0 || kind >= changeKindsCount {
+		return 0
+	}
+
+	return this.counts[kind]
+}
+
+// Report returns the summary of the messages compared so far.
+func (this *Comparison) Report() CompareReport {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	report := CompareReport{Messages: this.messages, Unchanged: this.counts[Unchanged]}
+
+	for kind := NewlyMatched; kind < changeKindsCount; kind++ {
+		if this.counts[kind] == 0 {
+			continue
+		}
+
+		report.Changes = append(report.Changes, ChangeCount{
+			Kind:    kind.String(),
+			Count:   this.counts[kind],
+			Samples: append([]Change(nil), this.changes[kind]...),
+		})
+	}
+
+	return report
+}
+
+// diffFields returns the fields that have different values in the old and new
+// field values, e.g., %srcuser% "jlz" -> "root", or an empty string if there
+// are none.
+func diffFields(old, new map[string]string) string {
+	names := make(map[string]bool)
+
+	for name := range old {
+		names[name] = true
+	}
+
+	for name := range new {
+		names[name] = true
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+
+	sort.Strings(sorted)
+
+	var diffs []string
+
+	for _, name := range sorted {
+		ov, ook := old[name]
+		nv, nok := new[name]
+
+		switch {
+		case !ook:
+			diffs = append(diffs, fmt.Sprintf("%s added %q", name, nv))
+
+		case !nok:
+			diffs = append(diffs, fmt.Sprintf("%s removed %q", name, ov))
+
+		case ov != nv:
+			diffs = append(diffs, fmt.Sprintf("%s %q -> %q", name, ov, nv))
+		}
+	}
+
+	return strings.Join(diffs, ", ")
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComparison(t *testing.T) {
+	build := func(pats ...string) *Parser {
+		parser := NewParser()
+
+		for _, pat := range pats {
+			seq, err := DefaultScanner.Tokenize(pat, nil)
+			require.NoError(t, err)
+			require.NoError(t, parser.Add(seq))
+		}
+
+		return parser
+	}
+
+	old := build(
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %srcuser% from %srcipv4% port %srcport% ssh2",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : invalid user %srcuser%",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : session opened for user %dstuser%",
+	)
+
+	new := build(
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser% from %srcipv4% port %srcport% ssh2",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : received disconnect from %srcipv4% : %integer% : bye bye",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : session %string% for user %dstuser%",
+	)
+
+	cmp := NewComparison(old, new, 1)
+
+	for _, tc := range []struct {
+		msg    string
+		kind   ChangeKind
+		fields string
+	}{
+		{"Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2", FieldsChanged, `%dstuser% added "jlz", %srcuser% removed "jlz"`},
+		{"Jan 15 19:39:27 irc sshd[7779]: Connection closed by 108.61.8.125", Unchanged, ""},
+		{"Jan 15 19:39:28 irc sshd[7780]: Connection closed by 108.61.8.126", Unchanged, ""},
+		{"Jan 15 19:39:29 irc sshd[7781]: Received disconnect from 108.61.8.127: 11: Bye Bye", NewlyMatched, ""},
+		{"Jan 15 19:39:30 irc sshd[7782]: Invalid user admin", NewlyUnmatched, ""},
+		{"Jan 15 19:39:31 irc sshd[7783]: Invalid user root", NewlyUnmatched, ""},
+		{"Jan 15 19:39:32 irc sshd[7784]: Session opened for user root", PatternChanged, ""},
+		{"totally unknown line here", Unchanged, ""},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+
+		change := cmp.Compare(seq, tc.msg)
+		require.Equal(t, tc.kind, change.Kind, tc.msg)
+		require.Equal(t, tc.fields, change.Fields, tc.msg)
+	}
+
+	report := cmp.Report()
+	require.Equal(t, 8, report.Messages)
+	require.Equal(t, 3, report.Unchanged)
+	require.Len(t, report.Changes, 4)
+
+	require.Equal(t, "matched", report.Changes[0].Kind)
+	require.Equal(t, 1, report.Changes[0].Count)
+	require.Equal(t, "", report.Changes[0].Samples[0].OldPattern)
+	require.Contains(t, report.Changes[0].Samples[0].NewPattern, "received disconnect")
+
+	require.Equal(t, "unmatched", report.Changes[1].Kind)
+	require.Equal(t, 2, report.Changes[1].Count)
+	require.Len(t, report.Changes[1].Samples, 1)
+	require.Contains(t, report.Changes[1].Samples[0].Message, "Invalid user admin")
+
+	require.Equal(t, "pattern", report.Changes[2].Kind)
+	require.Equal(t, "fields", report.Changes[3].Kind)
+
+	require.Equal(t, 2, cmp.Count(NewlyUnmatched))
+	require.Equal(t, NewlyUnmatched, ChangeKindFromString("unmatched"))
+	require.Equal(t, ChangeKind(-1), ChangeKindFromString("nosuchkind"))
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// constraint limits the values a pattern token matches. It's written after the
+// name of the %tag%, separated by a colon, as a list of alternatives separated
+// by |. What the alternatives are depends on the token type of the tag, e.g.,
+//
+//   %srcport:1-1023|8080%           integers, or ranges of them
+//   %srcipv4:10.0.0.0/8|127.0.0.1%  IP addresses, or networks in CIDR notation
+//   %action:accept|deny%            values, for all the other token types
+//   %literal:tcp|udp%               literals, as alternatives of each other
+//
+// Values are compared case-insensitively.
+type constraint struct {
+	src string
+
+	ranges [][2]int64
+	nets   []*net.IPNet
+	values map[string]bool
+}
+
+// newConstraint returns the constraint for the token type.
+func newConstraint(t TokenType, s string) (*constraint, error) {
+	this := &constraint{src: s}
+
+	for _, alt := range strings.Split(s, "|") {
+		if alt == "" {
+			return nil, fmt.Errorf("sequence: empty alternative in constraint %s", s)
+		}
+
+		switch t {
+		case TokenInteger:
+			// the - of a range is the first one that's not a sign, e.g., -5--1
+			lo, hi := alt, alt
+			if i := strings.IndexByte(alt[1:], '-'); i >= 0 {
+				lo, hi = alt[:i+1], alt[i+2:]
+			}
+
+			min, ok1 := parseInt(lo)
+			max, ok2 := parseInt(hi)
+			if !ok1 || !ok2 || min > max {
+				return nil, fmt.Errorf("sequence: invalid integer range %s in constraint %s", alt, s)
+			}
+
+			this.ranges = append(this.ranges, [2]int64{min, max})
+
+		case TokenIPv4, TokenIPv6:
+			// a single address is a network of its own
+			if ip := net.ParseIP(alt); ip != nil && ip.To4() != nil {
+				alt += "/32"
+			} else if ip != nil {
+				alt += "/128"
+			}
+
+			_, ipnet, err := net.ParseCIDR(alt)
+			if err != nil {
+				return nil, fmt.Errorf("sequence: invalid IP address or network %s in constraint %s", alt, s)
+			}
+
+			this.nets = append(this.nets, ipnet)
+
+		default:
+			if this.values == nil {
+				this.values = make(map[string]bool)
+			}
+
+			this.values[strings.ToLower(alt)] = true
+		}
+	}
+
+	return this, nil
+}
+
+// match returns true if the value satisfies the constraint. A nil constraint
+// matches any value.
+func (this *constraint) match(v string) bool {
+	if this == nil {
+		return true
+	}
+
+	switch {
+	case this.ranges != nil:
+		i, ok := parseInt(v)
+		if !ok {
+			return false
+		}
+
+		for _, r := range this.ranges {
+			if i >= r[0] && i <= r[1] {
+				return true
+			}
+		}
+
+	case this.nets != nil:
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return false
+		}
+
+		for _, n := range this.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+
+	default:
+		return this.values[strings.ToLower(v)]
+	}
+
+	return false
+}
+
+// sample returns a value that satisfies the constraint, the first one allowed by
+// its first alternative.
+func (this *constraint) sample() string {
+	switch {
+	case this.ranges != nil:
+		return strconv.FormatInt(this.ranges[0][0], 10)
+
+	case this.nets != nil:
+		return this.nets[0].IP.String()
+	}
+
+	return strings.ToLower(strings.Split(this.src, "|")[0])
+}
+
+func (this *constraint) String() string {
+	if this == nil {
+		return ""
+	}
+
+	return this.src
+}
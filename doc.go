@@ -71,12 +71,28 @@
 //
 // - A _TokenType_ indicates whether the token is a literal string (one that does
 // not change), a variable string (one that could have different values), an IPv4
-// or IPv6 address, a MAC address, an integer, a floating point number, or a
-// timestamp.
+// or IPv6 address, a MAC address, an integer, a floating point number, a
+// timestamp, a host name (%host%), an email address (%email%), an UUID (%uuid%),
+// a MD5, SHA1 or SHA256 hex digest (%hash%), an absolute file path (%path%), a
+// duration (%timespan%), a byte size (%bytes%) or a percentage (%percent%).
+// Patterns can use these to constrain what a token looks like, e.g., %path%
+// instead of %string%. A %string% still matches any of the last eight. The
+// normalized values of the numeric tokens, e.g., the number of seconds of
+// 0:00:30, are returned by Token.Int, Token.Float and Token.Duration, and the
+// time of a timestamp by Token.Time.
 //
 // - A _FieldType_ indicates the semantic meaning of the token. For example, a token
 // could be a source IP address (%srcipv4%), or a user (%srcuser% or %dstuser%),
-// an action (%action%) or a status (%status%).
+// an action (%action%) or a status (%status%). Applications can add their own
+// field types with RegisterField, or pattern files can declare them with @field.
+// Pattern files can also define macros for the parts that patterns share with
+// @define, and include other pattern files with @include, see ReadPatterns.
+//
+// In patterns, a %tag% can end with a repetition, e.g., %string?% for an optional
+// token, %string+% for one or more, %string{1,5}% for one to five, and %string-%
+// or %string-10% for the rest of the message, up to ten tokens, as a single value.
+// It can also limit the values it matches, e.g., %srcport:1-1023%,
+// %srcipv4:10.0.0.0/8%, %action:accepted|failed% or %literal:tcp|udp%.
 //
 // - A _Sequence_ is a list of Tokens. It is returned by the _Tokenizer_, and the _Parser_.
 //
@@ -84,7 +100,10 @@
 // sequence of tokens. It is sequential because it goes through log message sequentially
 // tokentizing each part of the message, without the use of regular expressions.
 // The scanner currently recognizes time stamps, IPv4 addresses, URLs, MAC addresses,
-// integers and floating point numbers.
+// integers and floating point numbers, including signed, hex, e.g., 0x1F3A,
+// exponent, e.g., 1e-3, and comma grouped, e.g., 1,024 or 1,024,000, ones, durations,
+// byte sizes, percentages, host names, email addresses, UUIDs, hex digests and
+// absolute file paths.
 //
 // - A _Analyzer_ builds an analysis tree that represents all the Sequences from messages.
 // It can be used to determine all of the unique patterns for a large body of messages.
@@ -92,7 +111,10 @@
 // - A _Parser_ is a tree-based parsing engine for log messages. It builds a parsing
 // tree based on pattern sequence supplied, and for each message sequence, returns
 // the matching pattern sequence. Each of the message tokens will be marked with the
-// semantic field types.
+// semantic field types. URLs in the parsed sequence can be broken into their
+// scheme, host, port, path, query and fragment with Decompose, which also splits
+// composite values, e.g., CORP\alice captured by %srcuser% into %srcdomain% and
+// %srcuser%, or 10.1.2.3:443 captured by %srchost% into %srcipv4% and %srcport%.
 //
 // ### Performance
 //
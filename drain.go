@@ -0,0 +1,359 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DrainAnalyzer finds the patterns of a set of messages by clustering them, based
+// on Drain, "Drain: An Online Log Parsing Approach with Fixed Depth Tree", by
+// Pinjia He, et al. Each message is routed down a tree of fixed depth, first by
+// its number of tokens, then by its first few tokens, to a leaf that has a list
+// of clusters. The message joins the cluster whose template is the most similar
+// to it, if the similarity is at least the threshold, and the tokens of the
+// template that differ from the message become variable. Otherwise the message
+// starts a new cluster.
+//
+// For example, the following messages
+//
+//   Jan 12 06:49:42 irc sshd[7034]: Accepted password for root from 218.161.81.238 port 4228 ssh2
+//   Jan 12 14:44:48 jlz sshd[11084]: Accepted publickey for jlz from 76.21.0.16 port 36609 ssh2
+//
+// have the same number of tokens, and start with the same type of token, so they
+// reach the same leaf. 13 of their 16 tokens are the same, so they are put in the
+// same cluster, with the template
+//
+//   %time% %string% sshd [ %integer% ] : accepted %string% for %string% from %ipv4% port %integer% ssh2
+//
+// Unlike the Analyzer, the patterns don't depend on which literals share a parent
+// and a child across all the messages, only on the messages in the same cluster,
+// so the two can be compared on the same corpus. The DrainAnalyzer has the same
+// Add, Finalize and Analyze methods, and its patterns are named with the same
+// rules, so they can be loaded into a Parser.
+type DrainAnalyzer struct {
+	opts DrainOptions
+
+	// root has a child for each number of tokens
+	root *drainNode
+
+	mu sync.RWMutex
+}
+
+// DrainOptions are the parameters of the DrainAnalyzer. The zero value of each
+// of them is replaced by its default.
+type DrainOptions struct {
+	// Depth is the number of leading tokens used to route a message to its leaf,
+	// 1 by default, since the first tokens of syslog messages are usually the
+	// time and the host, and routing by the host would keep the same messages from
+	// different hosts apart.
+	Depth int
+
+	// Threshold is the least similarity, the fraction of the tokens that are
+	// the same as the ones in the template, for a message to join a cluster, 0.5
+	// by default.
+	Threshold float64
+
+	// MaxChildren is the most children a node in the tree can have, including the
+	// "any" child that the messages with other tokens share once the node is
+	// full, 100 by default.
+	MaxChildren int
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+// drainCluster is a group of messages with the same template. A literal in the
+// template is a token that's the same in all the messages, and a token of another
+// type is a variable, where %string% matches any token.
+type drainCluster struct {
+	template Sequence
+	count    int
+}
+
+// drainAny is the key of the child that's used for tokens that are variable, or
+// when a node has too many children.
+const drainAny = "%any%"
+
+// PatternAnalyzer finds the patterns of a set of messages. All the messages are
+// added first, then Finalize is called, and then Analyze returns the pattern of
+// each message. Both the Analyzer and the DrainAnalyzer are PatternAnalyzers.
+type PatternAnalyzer interface {
+	Add(seq Sequence) error
+	Finalize() error
+	Analyze(seq Sequence) (Sequence, error)
+}
+
+var (
+	_ PatternAnalyzer = (*Analyzer)(nil)
+	_ PatternAnalyzer = (*DrainAnalyzer)(nil)
+)
+
+// NewDrainAnalyzer returns a DrainAnalyzer that uses the options, if they are
+// supplied, or the defaults otherwise.
+func NewDrainAnalyzer(opts ...DrainOptions) *DrainAnalyzer {
+	tree := &DrainAnalyzer{root: newDrainNode()}
+
+	if len(opts) > 0 {
+		tree.opts = opts[0]
+	}
+
+	if tree.opts.Depth <= 0 {
+		tree.opts.Depth = 1
+	}
+
+	if tree.opts.Threshold <= 0 {
+		tree.opts.Threshold = 0.5
+	}
+
+	if tree.opts.MaxChildren <= 0 {
+		tree.opts.MaxChildren = 100
+	}
+
+	return tree
+}
+
+func newDrainNode() *drainNode {
+	return &drainNode{children: make(map[string]*drainNode)}
+}
+
+// Add adds a single message sequence to the cluster it's the most similar to, or
+// to a new cluster if there's none that's similar enough.
+func (this *DrainAnalyzer) Add(seq Sequence) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if len(seq) == 0 {
+		return nil
+	}
+
+	leaf := this.leaf(seq, true)
+
+	if c, sim := this.cluster(leaf, seq); c != nil && sim >= this.opts.Threshold {
+		c.merge(seq)
+		return nil
+	}
+
+	c := &drainCluster{template: make(Sequence, len(seq)), count: 1}
+
+	for i, token := range seq {
+		c.template[i] = Token{Type: token.Type, Field: token.Field}
+
+		if token.Type == TokenLiteral {
+			c.template[i].Value = strings.ToLower(token.Value)
+		}
+	}
+
+	leaf.clusters = append(leaf.clusters, c)
+
+	return nil
+}
+
+// Finalize does nothing, since the clusters are updated as the messages are added.
+// It's there so the DrainAnalyzer has the same methods as the Analyzer.
+func (this *DrainAnalyzer) Finalize() error {
+	return nil
+}
+
+// Analyze returns the pattern of the cluster the message sequence belongs to, with
+// the values of the message, and the fields named the same way as the Analyzer
+// names them. It returns an error if no cluster matches the message.
+func (this *DrainAnalyzer) Analyze(seq Sequence) (Sequence, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	leaf := this.leaf(seq, false)
+	if leaf == nil {
+		return nil, ErrNoMatch
+	}
+
+	var best *drainCluster
+
+	for _, c := range leaf.clusters {
+		if c.matches(seq) && (best == nil || c.count > best.count) {
+			best = c
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoMatch
+	}
+
+	seq2 := make(Sequence, len(seq))
+
+	for i, token := range best.template {
+		seq2[i] = token
+		seq2[i].Value, seq2[i].isKey, seq2[i].isValue = seq[i].Value, seq[i].isKey, seq[i].isValue
+	}
+
+	return analyzeSequence(seq2), nil
+}
+
+// Clusters returns the number of clusters, which is the number of unique patterns
+// found so far.
+func (this *DrainAnalyzer) Clusters() int {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return this.root.clusterCount()
+}
+
+func (this *drainNode) clusterCount() int {
+	n := len(this.clusters)
+
+	for _, child := range this.children {
+		n += child.clusterCount()
+	}
+
+	return n
+}
+
+// leaf returns the leaf for the message, by its number of tokens and the first
+// Depth tokens. A token that doesn't have a child of its own goes to the "any"
+// child, when its node is full, or when the leaf is looked up for Analyze. If
+// create is true, the nodes that don't exist are created, otherwise nil is
+// returned.
+func (this *DrainAnalyzer) leaf(seq Sequence, create bool) *drainNode {
+	keys := []string{strconv.Itoa(len(seq))}
+
+	for i := 0; i < this.opts.Depth && i < len(seq); i++ {
+		keys = append(keys, drainKey(seq[i]))
+	}
+
+	cur := this.root
+
+	for i, key := range keys {
+		next, ok := cur.children[key]
+
+		if !ok && (!create || (i > 0 && len(cur.children) >= this.opts.MaxChildren-1)) {
+			key = drainAny
+			next, ok = cur.children[key]
+		}
+
+		if !ok {
+			if !create {
+				return nil
+			}
+
+			next = newDrainNode()
+			cur.children[key] = next
+		}
+
+		cur = next
+	}
+
+	return cur
+}
+
+// drainKey returns the key of the token in the tree, which is the literal itself,
+// or drainAny for the variables, and the literals that have digits in them.
+func drainKey(token Token) string {
+	if token.Type != TokenLiteral || strings.IndexFunc(token.Value, unicode.IsDigit) >= 0 {
+		return drainAny
+	}
+
+	return strings.ToLower(token.Value)
+}
+
+// cluster returns the cluster in the leaf that's the most similar to the message,
+// and the similarity. If there's a tie, the one with more variables wins.
+func (this *DrainAnalyzer) cluster(leaf *drainNode, seq Sequence) (*drainCluster, float64) {
+	var (
+		best    *drainCluster
+		bestSim = -1.0
+		bestVar int
+	)
+
+	for _, c := range leaf.clusters {
+		same, vars := c.similarity(seq)
+		sim := float64(same) / float64(len(seq))
+
+		if sim > bestSim || (sim == bestSim && vars > bestVar) {
+			best, bestSim, bestVar = c, sim, vars
+		}
+	}
+
+	return best, bestSim
+}
+
+// similarity returns the number of tokens in the message that are the same as the
+// ones in the template, and the number of %string% tokens in the template, which
+// aren't counted as the same, so the templates that are mostly variables don't
+// take in every message.
+func (this *drainCluster) similarity(seq Sequence) (same, vars int) {
+	for i, t := range this.template {
+		switch {
+		case t.Type == TokenString:
+			vars++
+
+		case t.Type == TokenLiteral:
+			if seq[i].Type == TokenLiteral && strings.EqualFold(t.Value, seq[i].Value) {
+				same++
+			}
+
+		case t.Type == seq[i].Type:
+			same++
+		}
+	}
+
+	return same, vars
+}
+
+// merge adds the message to the cluster, and turns the tokens of the template that
+// differ from the message into variables, of the same type as both, if they have
+// the same type, or %string% otherwise.
+func (this *drainCluster) merge(seq Sequence) {
+	this.count++
+
+	for i, t := range this.template {
+		m := seq[i]
+
+		switch {
+		case t.Type == TokenLiteral && m.Type == TokenLiteral && strings.EqualFold(t.Value, m.Value):
+
+		case t.Type != TokenLiteral && t.Type == m.Type:
+			if t.Field != m.Field {
+				this.template[i].Field = FieldUnknown
+			}
+
+		default:
+			this.template[i] = Token{Type: TokenString}
+		}
+	}
+}
+
+// matches returns true if every token of the message fits the template.
+func (this *drainCluster) matches(seq Sequence) bool {
+	for i, t := range this.template {
+		switch {
+		case t.Type == TokenString:
+
+		case t.Type == TokenLiteral:
+			if seq[i].Type != TokenLiteral || !strings.EqualFold(t.Value, seq[i].Value) {
+				return false
+			}
+
+		case t.Type != seq[i].Type:
+			return false
+		}
+	}
+
+	return true
+}
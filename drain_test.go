@@ -0,0 +1,135 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var drainTests = []struct {
+	msg, pat string
+}{
+	{
+		"Jan 12 06:49:42 irc sshd[7034]: Accepted password for root from 218.161.81.238 port 4228 ssh2",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcipv4% port %srcport% ssh2",
+	},
+	{
+		"Jan 12 14:44:48 jlz sshd[11084]: Accepted publickey for jlz from 76.21.0.16 port 36609 ssh2",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : %status% %method% for %srcuser% from %srcipv4% port %srcport% ssh2",
+	},
+	{
+		"Jan 12 06:49:43 irc sshd[7035]: Received disconnect from 218.161.81.238: 11: Bye Bye",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : received %action% from %srcipv4% : %srcport% : bye bye",
+	},
+	{
+		"Jan 12 06:49:44 irc sshd[7036]: Received disconnect from 218.161.81.239: 11: Bye Bye",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : received %action% from %srcipv4% : %srcport% : bye bye",
+	},
+	{
+		"Jan 12 06:49:44 irc sshd[7036]: Invalid user admin from 218.161.81.239",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : invalid user %srcuser% from %srcipv4%",
+	},
+	{
+		"worker job alpha started on node1",
+		"worker job %string% %action% on %string%",
+	},
+	{
+		"worker job beta started on node2",
+		"worker job %string% %action% on %string%",
+	},
+}
+
+func TestDrainAnalyzer(t *testing.T) {
+	var atree PatternAnalyzer = NewDrainAnalyzer()
+
+	for _, tc := range drainTests {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq))
+	}
+
+	require.NoError(t, atree.Finalize())
+	require.Equal(t, 4, atree.(*DrainAnalyzer).Clusters())
+
+	parser := NewParser()
+
+	for _, tc := range drainTests {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+
+		aseq, err := atree.Analyze(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pat, aseq.String(), tc.msg)
+
+		// the patterns load into a parser, and match the messages
+		pseq, err := DefaultScanner.Tokenize(aseq.String(), nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(pseq))
+
+		seq, err = DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+
+		_, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+	}
+
+	seq, err := DefaultScanner.Tokenize("worker job gamma stopped on node3 after 10 seconds", nil)
+	require.NoError(t, err)
+
+	_, err = atree.Analyze(seq)
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestDrainAnalyzerOptions(t *testing.T) {
+	msgs := []string{
+		"worker job alpha started on node1",
+		"worker job beta stopped on node1",
+	}
+
+	for _, tc := range []struct {
+		opts     DrainOptions
+		clusters int
+	}{
+		// 4 of 6 tokens are the same
+		{DrainOptions{}, 1},
+		{DrainOptions{Threshold: 0.7}, 2},
+
+		// routed by the 3rd token, alpha or beta, to different leaves
+		{DrainOptions{Depth: 3}, 2},
+
+		// the 3rd tokens share the "any" child, as it's the only one there can be
+		{DrainOptions{Depth: 3, MaxChildren: 1}, 1},
+	} {
+		atree := NewDrainAnalyzer(tc.opts)
+
+		for _, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+			require.NoError(t, atree.Add(seq))
+		}
+
+		require.Equal(t, tc.clusters, atree.Clusters(), "%+v", tc.opts)
+
+		for _, msg := range msgs {
+			seq, err := DefaultScanner.Tokenize(msg, nil)
+			require.NoError(t, err)
+
+			_, err = atree.Analyze(seq)
+			require.NoError(t, err, "%+v: %s", tc.opts, msg)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExampleResult is the result of parsing one of the examples of a pattern.
+type ExampleResult struct {
+	File    string // file of the pattern
+	Line    int    // line of the pattern
+	Pattern string
+	Example string
+
+	// Err is why the example failed, or nil if it passed
+	Err error
+}
+
+// CheckExamples adds the patterns to a parser, in order, and parses each of their
+// examples, tokenized with the scanner. An example passes if it's matched by its
+// own pattern, and the fields of the parsed message, after Decompose, have the
+// expected values, if there are any. Values are compared case-insensitively, and
+// a field with more than one value, e.g., from %string+%, has them separated by a
+// space. A pattern that can't be added fails all of its examples.
+func CheckExamples(defs []PatternDef, scanner Scanner) []ExampleResult {
+	var (
+		parser  = NewParser()
+		ids     = make([]string, len(defs))
+		errs    = make([]error, len(defs))
+		byID    = make(map[string]int)
+		results []ExampleResult
+	)
+
+	for i, def := range defs {
+		seq, err := DefaultScanner.Tokenize(def.Pattern, nil)
+		if err == nil {
+			err = parser.Add(seq)
+		}
+
+		if err != nil {
+			errs[i] = fmt.Errorf("pattern can't be added: %s", strings.TrimPrefix(err.Error(), "sequence: "))
+			continue
+		}
+
+		ids[i] = PatternID(AsPattern(seq))
+		if _, ok := byID[ids[i]]; !ok {
+			byID[ids[i]] = i
+		}
+	}
+
+	for i, def := range defs {
+		for j, ex := range def.Examples {
+			res := ExampleResult{File: def.File, Line: def.Line, Pattern: def.Pattern, Example: ex, Err: errs[i]}
+
+			if res.Err == nil {
+				seq, err := scanner.Tokenize(ex, nil)
+				if err != nil {
+					res.Err = err
+				} else if pseq, id, err := parser.ParsePattern(seq); err != nil {
+					res.Err = fmt.Errorf("no pattern matched")
+				} else if id != ids[i] {
+					other := defs[byID[id]]
+					res.Err = fmt.Errorf("matched the pattern at %s:%d instead, %s", other.File, other.Line, other.Pattern)
+				} else {
+					res.Err = checkFields(Decompose(pseq), def.Expected[j])
+				}
+			}
+
+			results = append(results, res)
+		}
+	}
+
+	return results
+}
+
+// checkFields returns an error listing the fields of the parsed sequence that
+// don't have the expected values.
+func checkFields(pseq Sequence, expected map[string]string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	values := fieldValues(pseq)
+
+	var names []string
+	for name := range expected {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var diffs []string
+
+	for _, name := range names {
+		if v, ok := values[name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is missing, expected %q", name, expected[name]))
+		} else if !strings.EqualFold(v, expected[name]) {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, expected %q", name, v, expected[name]))
+		}
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s", strings.Join(diffs, ", "))
+	}
+
+	return nil
+}
+
+// fieldValues returns the values of the fields in the parsed sequence, keyed by
+// the field names, e.g., %srcuser%. A field with more than one value has them
+// separated by a space.
+func fieldValues(pseq Sequence) map[string]string {
+	values := make(map[string]string)
+
+	for _, token := range pseq {
+		if token.Field == FieldUnknown {
+			continue
+		}
+
+		if v, ok := values[token.Field.String()]; ok {
+			values[token.Field.String()] = v + " " + token.Value
+		} else {
+			values[token.Field.String()] = token.Value
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckExamples(t *testing.T) {
+	defs, err := ReadPatterns(strings.NewReader(`
+%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %srcuser% from %srcipv4% port %srcport% ssh2
+# Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2
+# => srcuser=jlz %srcport%=57630 msgtime="Jan 15 19:39:26"
+# Jan 15 19:39:26 irc sshd[7778]: Accepted password for CORP\jlz from 108.61.8.124 port 57630 ssh2
+# => srcuser=jlz srcdomain=corp
+# Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 22 ssh2
+# => srcport=57630 srcipv4=108.61.8.124 dstuser=root
+# Jan 15 19:39:26 irc sshd[7778]: Failed password for jlz from 108.61.8.124 port 22 ssh2
+# Jan 15 19:39:26 irc sshd[7778]: Accepted publickey for jlz from 108.61.8.124 port 22 ssh2
+
+%msgtime% %apphost% %appname% [ %sessionid% ] : %action% password for %srcuser% from %srcipv4% port %srcport% ssh2
+%msgtime% %apphost% %appname% : %nosuchfield%
+# Jan 15 19:39:26 irc sshd: x
+`), "sshd.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[int]map[string]string{
+		0: {"%srcuser%": "jlz", "%srcport%": "57630", "%msgtime%": "Jan 15 19:39:26"},
+		1: {"%srcuser%": "jlz", "%srcdomain%": "corp"},
+		2: {"%srcport%": "57630", "%srcipv4%": "108.61.8.124", "%dstuser%": "root"},
+	}, defs[0].Expected)
+
+	var errs []string
+	for _, res := range CheckExamples(defs, DefaultScanner) {
+		if res.Err == nil {
+			errs = append(errs, "")
+		} else {
+			errs = append(errs, res.Err.Error())
+		}
+	}
+
+	require.Equal(t, []string{
+		"",
+		"",
+		`%dstuser% is missing, expected "root", %srcport% is "22", expected "57630"`,
+		"matched the pattern at sshd.txt:12 instead, %msgtime% %apphost% %appname% [ %sessionid% ] : %action% password for %srcuser% from %srcipv4% port %srcport% ssh2",
+		"no pattern matched",
+		"pattern can't be added: unknown field or token type %nosuchfield%",
+	}, errs)
+
+	for _, tc := range []struct {
+		data, err string
+	}{
+		{"%string%\n# => string=a\n", "test.txt:2: expected field values without an example"},
+		{"%string%\n# a\n# => string\n", `test.txt:3: expecting field=value, got "string"`},
+		{"%string%\n# a\n# => string=\"a\n", "test.txt:3: missing closing quote for the value of %string%"},
+	} {
+		_, err := ReadPatterns(strings.NewReader(tc.data), "test.txt")
+		require.EqualError(t, err, tc.err, tc.data)
+	}
+}
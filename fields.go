@@ -0,0 +1,137 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// customFields maps the labels of the registered fields, e.g., %vlan%, to
+	// their field types
+	customFields = make(map[string]FieldType)
+
+	// customMu guards customFields and fields, since fields can be registered
+	// while the patterns are read
+	customMu sync.RWMutex
+
+	// builtinFields is the table of the built-in fields, which doesn't change, so
+	// it's read without customMu. Its capacity is its length, so the registered
+	// fields are appended to a copy.
+	builtinFields = fields[:len(fields):len(fields)]
+)
+
+// RegisterField adds a new field type, in addition to the ones built into the
+// package, so it can be used in patterns, e.g., %vlan% or %tenant%. The name can be
+// given with or without the surrounding %'s, and ttype is the type of token the
+// field values are, e.g., TokenInteger for %vlan%.
+//
+// Registering a name that's already registered with the same token type returns
+// the existing field type. Fields can be registered while other goroutines are
+// parsing messages, but an Analyzer only knows the fields registered before it's
+// created.
+func RegisterField(name string, ttype TokenType) (FieldType, error) {
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	label := fieldLabel(name)
+	if len(label) < 3 {
+		return FieldUnknown, fmt.Errorf("sequence: invalid field name %q", name)
+	}
+
+	for _, c := range label[1 : len(label)-1] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			return FieldUnknown, fmt.Errorf("sequence: invalid field name %q", name)
+		}
+	}
+
+	if ttype <= TokenLiteral || ttype >= token__END__ {
+		return FieldUnknown, fmt.Errorf("sequence: invalid token type %d for field %s", int(ttype), label)
+	}
+
+	if name2TokenType(label) != TokenUnknown {
+		return FieldUnknown, fmt.Errorf("sequence: field %s is a token type", label)
+	}
+
+	// customMu is held, so the fields are looked up without name2FieldType
+	f, ok := customFields[label]
+
+	for i := FieldUnknown + 1; !ok && i < field__END__; i++ {
+		f, ok = i, fields[i].label == label
+	}
+
+	if ok {
+		if fields[f].ttype != ttype {
+			return FieldUnknown, fmt.Errorf("sequence: field %s is already registered as %s", label, fields[f].ttype)
+		}
+
+		return f, nil
+	}
+
+	f = FieldType(len(fields))
+	fields = append(fields, struct {
+		label string
+		ttype TokenType
+	}{label, ttype})
+
+	customFields[label] = f
+
+	return f, nil
+}
+
+// FieldTypeByName returns the field type with the name, with or without the
+// surrounding %'s, or FieldUnknown if there's no such field.
+func FieldTypeByName(name string) FieldType {
+	return name2FieldType(fieldLabel(name))
+}
+
+// fieldTypesCount returns the number of field types, including the registered ones
+func fieldTypesCount() int {
+	customMu.RLock()
+	defer customMu.RUnlock()
+
+	return len(fields)
+}
+
+// fieldDef returns the label and the token type of the field. Only the registered
+// fields take the lock, since it's called for every token.
+func fieldDef(f FieldType) (string, TokenType) {
+	if int(f) < len(builtinFields) {
+		return builtinFields[f].label, builtinFields[f].ttype
+	}
+
+	customMu.RLock()
+	defer customMu.RUnlock()
+
+	return fields[f].label, fields[f].ttype
+}
+
+// registeredField returns the registered field type for the label, or FieldUnknown
+func registeredField(label string) FieldType {
+	customMu.RLock()
+	defer customMu.RUnlock()
+
+	if f, ok := customFields[label]; ok {
+		return f
+	}
+
+	return FieldUnknown
+}
+
+func fieldLabel(name string) string {
+	return "%" + strings.Trim(strings.ToLower(name), "%") + "%"
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterField(t *testing.T) {
+	vlan, err := RegisterField("vlan", TokenInteger)
+	require.NoError(t, err)
+	require.Equal(t, "%vlan%", vlan.String())
+	require.Equal(t, TokenInteger, vlan.TokenType())
+	require.Equal(t, vlan, FieldTypeByName("%vlan%"))
+
+	f, err := RegisterField("%VLAN%", TokenInteger)
+	require.NoError(t, err)
+	require.Equal(t, vlan, f)
+
+	_, err = RegisterField("vlan", TokenString)
+	require.Error(t, err)
+
+	_, err = RegisterField("srcport", TokenString)
+	require.Error(t, err)
+
+	_, err = RegisterField("integer", TokenString)
+	require.Error(t, err)
+
+	_, err = RegisterField("url path", TokenString)
+	require.Error(t, err)
+
+	_, err = RegisterField("tenant", TokenLiteral)
+	require.Error(t, err)
+
+	f, err = RegisterField("srcport", TokenInteger)
+	require.NoError(t, err)
+	require.Equal(t, FieldSrcPort, f)
+}
+
+func TestRegisterFieldParseAnalyze(t *testing.T) {
+	defs, err := ReadPatterns(strings.NewReader(`
+@field %tenant% %string%
+@field %url_path% %string%
+
+# a comment
+%msgtime% %apphost% proxy : tenant = %tenant% vlan %integer% get %url_path%
+# Jan 12 06:49:42 irc proxy: tenant=acme vlan 10 get /index.html
+# Jan 12 06:49:43 irc proxy: tenant=initech vlan 12 get /
+
+%msgtime% %apphost% proxy : %tenant% %unknown_field%
+`), "test.txt")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(defs))
+	require.Equal(t, 6, defs[0].Line)
+	require.Equal(t, 2, len(defs[0].Examples))
+
+	tenant := FieldTypeByName("tenant")
+	require.NotEqual(t, FieldUnknown, tenant)
+
+	parser := NewParser()
+	seq, err := DefaultScanner.Tokenize(defs[0].Pattern, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, err = DefaultScanner.Tokenize(defs[1].Pattern, nil)
+	require.NoError(t, err)
+	require.Error(t, parser.Add(seq))
+
+	for _, ex := range defs[0].Examples {
+		seq, err := DefaultScanner.Tokenize(ex, nil)
+		require.NoError(t, err)
+		pseq, err := parser.Parse(seq)
+		require.NoError(t, err, ex)
+		require.Equal(t, defs[0].Pattern, pseq.String())
+	}
+
+	analyzer := NewAnalyzer()
+	seq, err = DefaultScanner.Tokenize(defs[0].Pattern, nil)
+	require.NoError(t, err)
+	require.NoError(t, analyzer.Add(seq))
+	require.NoError(t, analyzer.Finalize())
+
+	seq, err = DefaultScanner.Tokenize(defs[0].Examples[0], nil)
+	require.NoError(t, err)
+	aseq, err := analyzer.Analyze(seq)
+	require.NoError(t, err)
+	require.Equal(t, tenant, aseq[6].Field, aseq.PrintTokens())
+
+	_, err = ReadPatterns(strings.NewReader("@field %vlan2%\n"), "bad.txt")
+	require.EqualError(t, err, `bad.txt:1: expecting @field %name% %type%, got "@field %vlan2%"`)
+}
+
+func TestRegisterFieldConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 100; i++ {
+			_, err := RegisterField(fmt.Sprintf("concurrent%d", i), TokenInteger)
+			require.NoError(t, err)
+		}
+	}()
+
+	// the built-in fields are read while the others are registered
+	for i := 0; i < 1000; i++ {
+		require.Equal(t, "%srcipv4%", FieldSrcIPv4.String())
+		require.Equal(t, TokenIPv4, FieldSrcIPv4.TokenType())
+	}
+
+	wg.Wait()
+
+	f := FieldTypeByName("concurrent99")
+	require.Equal(t, "%concurrent99%", f.String())
+	require.Equal(t, TokenInteger, f.TokenType())
+}
@@ -37,12 +37,18 @@ var (
 		{"%ipv6%", "TokenIPv6", "Token is an IPv6 address, not currently supported"},
 		{"%integer%", "TokenInteger", "Token is an integer number"},
 		{"%float%", "TokenFloat", "Token is a floating point number"},
-		{"%url%", "TokenURL", "Token is an URL, in the form of http://... or https://..."},
+		{"%url%", "TokenURL", "Token is an URL, e.g., http://..., ftp://... or www.example.com/a?b=c"},
 		{"%mac%", "TokenMac", "Token is a mac address"},
 		{"%string%", "TokenString", "Token is a string that reprensents multiple possible values"},
+		{"%host%", "TokenHost", "Token is a host name, e.g., www.example.com"},
+		{"%email%", "TokenEmail", "Token is an email address, e.g., root@example.com"},
+		{"%uuid%", "TokenUUID", "Token is an UUID, e.g., 123e4567-e89b-12d3-a456-426614174000"},
+		{"%hash%", "TokenHash", "Token is a MD5, SHA1 or SHA256 hex digest"},
+		{"%path%", "TokenPath", "Token is an absolute file path, e.g., /var/log/messages"},
+		{"%timespan%", "TokenDuration", "Token is a duration, e.g., 0:00:30, 5m3s or 123ms"},
+		{"%bytes%", "TokenBytes", "Token is a byte size, e.g., 1.5MB or 4GiB"},
+		{"%percent%", "TokenPercent", "Token is a percentage, e.g., 87%"},
 		{"token__END__", "token__END__", "All field types must be inserted before this one"},
-		{"token__host__", "token__host__", "Token is a host name"},
-		{"token__email__", "token__email__", "Token is an email address"},
 	}
 
 	fields = []struct {
@@ -99,11 +105,19 @@ var (
 		{"%method%", "FieldMethod", "TokenString", "The method in which the action was taken, for example, public key or password for ssh"},
 		{"%status%", "FieldStatus", "TokenString", "The status of the action taken"},
 		{"%reason%", "FieldReason", "TokenString", "The reason for the action taken or the status returned"},
-		{"%bytesrecv%", "FieldBytesRecv", "TokenInteger", "The number of bytes received"},
-		{"%bytessent%", "FieldBytesSent", "TokenInteger", "The number of bytes sent"},
+		{"%bytesrecv%", "FieldBytesRecv", "TokenBytes", "The number of bytes received"},
+		{"%bytessent%", "FieldBytesSent", "TokenBytes", "The number of bytes sent"},
 		{"%pktsrecv%", "FieldPktsRecv", "TokenInteger", "The number of packets received"},
 		{"%pktssent%", "FieldPktsSent", "TokenInteger", "The number of packets sent"},
-		{"%duration%", "FieldDuration", "TokenString", "The duration of the session"},
+		{"%duration%", "FieldDuration", "TokenDuration", "The duration of the session"},
+		{"%urlscheme%", "FieldURLScheme", "TokenString", "The scheme of the URL, e.g., http or ftp"},
+		{"%urlhost%", "FieldURLHost", "TokenString", "The host name or IP address of the URL"},
+		{"%urlport%", "FieldURLPort", "TokenInteger", "The port of the URL"},
+		{"%urlpath%", "FieldURLPath", "TokenString", "The path of the URL"},
+		{"%urlquery%", "FieldURLQuery", "TokenString", "The query string of the URL, without the ?"},
+		{"%urlfragment%", "FieldURLFragment", "TokenString", "The fragment of the URL, without the #"},
+		{"%urlparam%", "FieldURLParam", "TokenString", "The name of a query parameter of the URL"},
+		{"%urlparamval%", "FieldURLParamVal", "TokenString", "The value of the query parameter before it"},
 		{"field__END__", "field__END__", "TokenString", "All field types must be inserted before this one"},
 	}
 )
@@ -140,6 +154,7 @@ type Token struct {
 	Type  TokenType // Type is the type of token the Value represents.
 	Field FieldType // Field determines which field the Value should be.
 	Value string    // Value is the extracted string from the log message.
+	Meta  string    // Meta is the repetition of the token in a pattern, e.g., ? or {1,5}.
 
 	isValue bool // Is this token a key in k=v pair
 	isKey   bool // Is this token a value in k=v pair
@@ -158,8 +173,10 @@ type (
 )
 
 const (
-	metaMore = '+'
-	metaRest = '-'
+	metaOptional = '?'
+	metaMore     = '+'
+	metaRest     = '-'
+	metaRepeat   = '{'
 )
 
 const (
@@ -172,7 +189,7 @@ const (
 )
 
 const (
-`, time.Now())
+`, time.Now().Round(0))
 
 	for i, t := range tokens {
 		if i == 0 {
@@ -222,7 +239,8 @@ func (this TokenType) String() string {
 }
 
 func (this FieldType) String() string {
-	return fields[this].label
+	label, _ := fieldDef(this)
+	return label
 }
 
 func name2TokenType(s string) TokenType {
@@ -246,11 +264,12 @@ func name2FieldType(s string) FieldType {
 
 	fmt.Fprintln(file, `	}
 
-	return FieldUnknown
+	return registeredField(s)
 }
 
 func (this FieldType) TokenType() TokenType {
-	return fields[this].ttype
+	_, ttype := fieldDef(this)
+	return ttype
 }`)
 }
 
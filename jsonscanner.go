@@ -0,0 +1,112 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONScanner is a lexical analyzer for messages that are JSON objects. The object
+// is flattened into key, "=", value tokens, in the order they appear in the message.
+// Keys of nested objects are joined with ".", e.g., {"user":{"name":"bob"}} becomes
+// user.name = bob, and array elements are indexed, e.g., tags.0 = a.
+type JSONScanner struct {
+}
+
+var _ Scanner = (*JSONScanner)(nil)
+
+// Tokenize returns a Sequence, or a list of tokens, for the data string supplied.
+func (this *JSONScanner) Tokenize(s string, seq Sequence) (Sequence, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := t.(json.Delim); !ok || d != '{' {
+		return nil, fmt.Errorf("sequence: not a JSON object: %s", s)
+	}
+
+	return this.object(dec, "", seq)
+}
+
+// object tokenizes the members of an object, up to and including the closing '}'
+func (this *JSONScanner) object(dec *json.Decoder, prefix string, seq Sequence) (Sequence, error) {
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if seq, err = this.value(dec, prefix+t.(string), seq); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := dec.Token()
+	return seq, err
+}
+
+// value tokenizes the next value in the decoder, using key as its key
+func (this *JSONScanner) value(dec *json.Decoder, key string, seq Sequence) (Sequence, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	var v string
+
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '{' {
+			return this.object(dec, key+".", seq)
+		}
+
+		// Otherwise it's an array
+		for i := 0; dec.More(); i++ {
+			if seq, err = this.value(dec, key+"."+strconv.Itoa(i), seq); err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = dec.Token()
+		return seq, err
+
+	case string:
+		v = t
+
+	case json.Number:
+		v = t.String()
+
+	case bool:
+		v = strconv.FormatBool(t)
+
+	case nil:
+		v = "null"
+	}
+
+	seq = append(seq, Token{Type: TokenLiteral, Value: key, isKey: true}, Token{Type: TokenLiteral, Value: "="})
+
+	if v != "" {
+		seq = append(seq, Token{Type: cellType(v), Value: v, isValue: true})
+	}
+
+	return seq, nil
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KVScanner is a lexical analyzer for messages made of key=value pairs, such as
+// "id=firewall time="2005-03-18 14:01:43" fw=TOPSEC priv=4". Each pair is returned
+// as the key, the "=" literal, and the value as a single token, even if the value
+// is quoted and contains spaces. Any text that is not part of a pair, such as a
+// syslog header, is tokenized by the DefaultScanner.
+type KVScanner struct {
+}
+
+// CEFScanner is a lexical analyzer for ArcSight Common Event Format messages, e.g.,
+//
+//   CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232
+//
+// The "|" separated header fields are returned as single tokens, separated by the
+// "|" literals. The extension is returned as key, "=", value tokens, where the value
+// runs until the next key, so it can contain spaces. Any text before "CEF:", such as
+// a syslog header, is tokenized by the DefaultScanner.
+type CEFScanner struct {
+}
+
+var (
+	_ Scanner = (*KVScanner)(nil)
+	_ Scanner = (*CEFScanner)(nil)
+)
+
+// Tokenize returns a Sequence, or a list of tokens, for the data string supplied.
+func (this *KVScanner) Tokenize(s string, seq Sequence) (Sequence, error) {
+	return tokenizePairs(s, seq, false)
+}
+
+// Tokenize returns a Sequence, or a list of tokens, for the data string supplied.
+func (this *CEFScanner) Tokenize(s string, seq Sequence) (Sequence, error) {
+	i := strings.Index(s, "CEF:")
+	if i < 0 {
+		return nil, fmt.Errorf("sequence: not a CEF message: %s", s)
+	}
+
+	seq, err := DefaultScanner.Tokenize(s[:i], seq)
+	if err != nil {
+		return nil, err
+	}
+
+	seq = append(seq, Token{Type: TokenLiteral, Value: "CEF"}, Token{Type: TokenLiteral, Value: ":"})
+
+	// The header has 7 fields, the version, device vendor, device product, device
+	// version, signature id, name and severity, each terminated by an unescaped |
+	start := i + 4
+	for n := 0; n < 7; n++ {
+		j := start
+		for ; j < len(s) && s[j] != '|'; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+
+		if j >= len(s) {
+			return nil, fmt.Errorf("sequence: incomplete CEF header: %s", s)
+		}
+
+		if v := strings.TrimSpace(s[start:j]); v != "" {
+			seq = append(seq, Token{Type: cellType(v), Value: v})
+		}
+
+		seq = append(seq, Token{Type: TokenLiteral, Value: "|"})
+		start = j + 1
+	}
+
+	return tokenizePairs(s[start:], seq, true)
+}
+
+// tokenizePairs tokenizes the key=value pairs in s. If spaces is true, then the
+// unquoted values can contain spaces, and run until the next key; otherwise they
+// end at the first space.
+func tokenizePairs(s string, seq Sequence, spaces bool) (Sequence, error) {
+	var err error
+
+	for cur := 0; cur < len(s); {
+		ks, eq := findKey(s, cur)
+		if ks < 0 {
+			ks, eq = len(s), len(s)
+		}
+
+		// Anything that's not a pair is tokenized as usual
+		if gap := strings.TrimSpace(s[cur:ks]); gap != "" {
+			if seq, err = DefaultScanner.Tokenize(gap, seq); err != nil {
+				return nil, err
+			}
+		}
+
+		if ks == len(s) {
+			break
+		}
+
+		seq = append(seq, Token{Type: TokenLiteral, Value: s[ks:eq], isKey: true}, Token{Type: TokenLiteral, Value: "="})
+
+		var v string
+		cur = eq + 1
+
+		switch {
+		case cur < len(s) && (s[cur] == '"' || s[cur] == '\''):
+			q := s[cur]
+			j := cur + 1
+			for ; j < len(s) && s[j] != q; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return nil, fmt.Errorf("sequence: unterminated quote: %s", s)
+			}
+
+			v, cur = s[cur+1:j], j+1
+
+		case spaces:
+			j, _ := findKey(s, cur)
+			if j < 0 {
+				j = len(s)
+			}
+
+			v, cur = strings.TrimSpace(s[cur:j]), j
+
+		default:
+			j := strings.IndexAny(s[cur:], " \t")
+			if j < 0 {
+				j = len(s) - cur
+			}
+
+			v, cur = strings.TrimRight(s[cur:cur+j], ",;"), cur+j
+		}
+
+		if v != "" {
+			seq = append(seq, Token{Type: cellType(v), Value: unescapeValue(v), isValue: true})
+		}
+	}
+
+	return seq, nil
+}
+
+// findKey returns the start of the next key and the index of its "=", at or after
+// position from. A key is a run of letters, digits, '_', '.' or '-' that starts
+// the string, or follows a space, ',' or ';'. It returns -1, -1 if there are none.
+func findKey(s string, from int) (int, int) {
+	for eq := strings.IndexByte(s[from:], '='); eq >= 0; {
+		eq += from
+
+		ks := eq
+		for ks > from && isKeyChar(s[ks-1]) {
+			ks--
+		}
+
+		if ks < eq && (ks == 0 || s[ks-1] == ' ' || s[ks-1] == '\t' || s[ks-1] == ',' || s[ks-1] == ';') &&
+			(eq == 0 || s[eq-1] != '\\') {
+
+			return ks, eq
+		}
+
+		from = eq + 1
+		eq = strings.IndexByte(s[from:], '=')
+	}
+
+	return -1, -1
+}
+
+func isKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+// unescapeValue removes the backslash in front of escaped characters
+func unescapeValue(v string) string {
+	if strings.IndexByte(v, '\\') < 0 {
+		return v
+	}
+
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		b = append(b, v[i])
+	}
+
+	return string(b)
+}
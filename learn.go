@@ -0,0 +1,249 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"sort"
+	"sync"
+)
+
+// MaxCandidateExamples is the most example messages kept for each Candidate.
+var MaxCandidateExamples = 3
+
+// MaxLearnSamples is the most messages with the same signature that the Learner
+// keeps, and analyzes, while they are waiting for a pattern. The ones past that
+// are only counted.
+var MaxLearnSamples = 100
+
+// Learner proposes patterns for the messages a parser can't match, while the
+// parser is being used, so finding the gaps in the patterns doesn't need a
+// separate run of the Analyzer over the messages. The messages are kept until
+// a pattern that matches them is accepted into the parser, at most
+// MaxLearnSamples of them for each signature, so the memory used, and the time it
+// takes to learn, don't grow with the number of messages. It's safe for concurrent
+// use.
+type Learner struct {
+	parser *Parser
+	opts   AnalyzerOptions
+
+	mu       sync.Mutex
+	groups   map[string]*learnGroup
+	sigs     []string
+	accepted []Candidate
+}
+
+// learnGroup is the messages with the same signature, and the number of them,
+// including the ones that aren't kept.
+type learnGroup struct {
+	msgs  []learnMessage
+	count int
+}
+
+type learnMessage struct {
+	seq Sequence
+	msg string
+}
+
+// weight returns the number of messages that the i-th kept message stands for,
+// which is the count spread evenly over the kept messages.
+func (this *learnGroup) weight(i int) int {
+	w := this.count / len(this.msgs)
+
+	if i < this.count%len(this.msgs) {
+		w++
+	}
+
+	return w
+}
+
+// Candidate is a pattern proposed by the Learner, with the number of messages
+// it's for, and some of them as the examples. ID is set if the pattern has been
+// accepted into the parser.
+type Candidate struct {
+	Pattern  string
+	Count    int
+	Examples []string
+	ID       string
+}
+
+// NewLearner returns a Learner for the messages the parser can't match, which is
+// also where the accepted patterns are added. The messages are analyzed with the
+// options, if they are supplied, or the zero AnalyzerOptions otherwise.
+func NewLearner(parser *Parser, opts ...AnalyzerOptions) *Learner {
+	l := &Learner{parser: parser, groups: make(map[string]*learnGroup)}
+
+	if len(opts) > 0 {
+		l.opts = opts[0]
+	}
+
+	return l
+}
+
+// Add adds a message the parser couldn't match, with the sequence it's tokenized
+// into. The sequence is copied, so it can be reused by the caller. If there are
+// already MaxLearnSamples messages with the same signature, the message is only
+// counted.
+func (this *Learner) Add(seq Sequence, msg string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	sig := seq.Signature()
+
+	g, ok := this.groups[sig]
+	if !ok {
+		g = &learnGroup{}
+		this.groups[sig] = g
+		this.sigs = append(this.sigs, sig)
+	}
+
+	g.count++
+
+	if len(g.msgs) < MaxLearnSamples {
+		g.msgs = append(g.msgs, learnMessage{append(Sequence(nil), seq...), msg})
+	}
+}
+
+// Len returns the number of messages that are waiting for a pattern.
+func (this *Learner) Len() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var n int
+
+	for _, g := range this.groups {
+		n += g.count
+	}
+
+	return n
+}
+
+// Learn analyzes the messages that are waiting for a pattern, and returns the
+// patterns that are proposed for them, with the most messages first, followed by
+// the ones accepted so far. The messages that are only counted are split evenly
+// over the patterns of the ones kept with the same signature. If accept is more
+// than 0, the proposed patterns for at least that many messages are added to the
+// parser, and the messages the parser can now match are no longer kept. A
+// proposed pattern that can't be added to the parser is returned, but not
+// accepted.
+func (this *Learner) Learn(accept int) ([]Candidate, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	analyzer := NewAnalyzer(this.opts)
+
+	for _, sig := range this.sigs {
+		// a message that can't be added, e.g., one with a %tag% that's not a
+		// field, is left out of the analysis, rather than failing all of it
+		for _, m := range this.groups[sig].msgs {
+			analyzer.Add(m.seq)
+		}
+	}
+
+	if err := analyzer.Finalize(); err != nil {
+		return nil, err
+	}
+
+	var (
+		candidates []Candidate
+		byPattern  = make(map[string]int)
+	)
+
+	for _, sig := range this.sigs {
+		g := this.groups[sig]
+
+		for j, m := range g.msgs {
+			aseq, err := analyzer.Analyze(m.seq)
+			if err != nil {
+				continue
+			}
+
+			pat := aseq.String()
+
+			i, ok := byPattern[pat]
+			if !ok {
+				i = len(candidates)
+				byPattern[pat] = i
+				candidates = append(candidates, Candidate{Pattern: pat})
+			}
+
+			candidates[i].Count += g.weight(j)
+
+			if len(candidates[i].Examples) < MaxCandidateExamples {
+				candidates[i].Examples = append(candidates[i].Examples, m.msg)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Count > candidates[j].Count
+	})
+
+	if accept <= 0 {
+		return append(candidates, this.accepted...), nil
+	}
+
+	var pending []Candidate
+
+	for _, c := range candidates {
+		if c.Count < accept {
+			pending = append(pending, c)
+			continue
+		}
+
+		seq, err := DefaultScanner.Tokenize(c.Pattern, nil)
+		if err == nil {
+			err = this.parser.Add(seq)
+		}
+
+		if err != nil {
+			pending = append(pending, c)
+			continue
+		}
+
+		c.ID = PatternID(AsPattern(seq))
+		this.accepted = append(this.accepted, c)
+	}
+
+	// keep the messages the accepted patterns don't match, and the count of the
+	// ones they stand for
+	sigs := this.sigs[:0]
+
+	for _, sig := range this.sigs {
+		var (
+			g     = this.groups[sig]
+			msgs  []learnMessage
+			count int
+		)
+
+		for j, m := range g.msgs {
+			if _, err := this.parser.Parse(append(Sequence(nil), m.seq...)); err != nil {
+				msgs = append(msgs, m)
+				count += g.weight(j)
+			}
+		}
+
+		if len(msgs) == 0 {
+			delete(this.groups, sig)
+			continue
+		}
+
+		g.msgs, g.count = msgs, count
+		sigs = append(sigs, sig)
+	}
+
+	this.sigs = sigs
+
+	return append(pending, this.accepted...), nil
+}
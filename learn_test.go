@@ -0,0 +1,124 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLearner(t *testing.T) {
+	parser := NewParser()
+
+	seq, err := DefaultScanner.Tokenize("%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%", nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	learner := NewLearner(parser)
+
+	msgs := []string{
+		"Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2",
+		"Jan 15 19:39:27 irc sshd[7779]: Connection closed by 108.61.8.125",
+		"Jan 15 19:39:28 irc sshd[7780]: Accepted password for root from 108.61.8.126 port 22 ssh2",
+		"Jan 15 19:39:28 irc sshd[7780]: Accepted publickey for root from 108.61.8.126 port 22 ssh2",
+		"Jan 15 19:39:31 irc sshd[7783]: Invalid user admin",
+	}
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		if _, err := parser.Parse(seq); err != nil {
+			learner.Add(seq, msg)
+		}
+	}
+
+	require.Equal(t, 4, learner.Len())
+
+	// without accept, the candidates are only proposed
+	cands, err := learner.Learn(0)
+	require.NoError(t, err)
+	require.Len(t, cands, 2)
+	require.Equal(t, 3, cands[0].Count)
+	require.Equal(t, msgs[0], cands[0].Examples[0])
+	require.Equal(t, "", cands[0].ID)
+	require.Equal(t, 1, cands[1].Count)
+	require.Equal(t, 4, learner.Len())
+	require.Len(t, parser.Patterns(), 1)
+
+	cands, err = learner.Learn(2)
+	require.NoError(t, err)
+	require.Len(t, cands, 2)
+	require.Equal(t, 1, cands[0].Count)
+	require.Equal(t, "", cands[0].ID)
+	require.Equal(t, 3, cands[1].Count)
+	require.NotEqual(t, "", cands[1].ID)
+	require.Equal(t, 1, learner.Len())
+	require.Len(t, parser.Patterns(), 2)
+
+	// the accepted pattern matches new messages
+	seq, err = DefaultScanner.Tokenize("Jan 15 19:40:01 irc sshd[7790]: Accepted password for bob from 10.1.2.3 port 2222 ssh2", nil)
+	require.NoError(t, err)
+
+	_, id, err := parser.ParsePattern(seq)
+	require.NoError(t, err)
+	require.Equal(t, cands[1].ID, id)
+
+	// and it's still returned, but not added again
+	cands, err = learner.Learn(2)
+	require.NoError(t, err)
+	require.Len(t, cands, 2)
+	require.Len(t, parser.Patterns(), 2)
+}
+
+func TestLearnerMaxSamples(t *testing.T) {
+	defer func(n int) { MaxLearnSamples = n }(MaxLearnSamples)
+	MaxLearnSamples = 2
+
+	parser := NewParser()
+	learner := NewLearner(parser)
+
+	msgs := []string{
+		"Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2",
+		"Jan 15 19:39:28 irc sshd[7780]: Accepted password for root from 108.61.8.126 port 22 ssh2",
+		"Jan 15 19:39:29 irc sshd[7781]: Accepted password for bob from 108.61.8.127 port 2222 ssh2",
+		"Jan 15 19:39:30 irc sshd[7782]: Accepted password for amy from 108.61.8.128 port 2200 ssh2",
+		"Jan 15 19:39:31 irc sshd[7783]: Connection closed by 108.61.8.125",
+	}
+
+	for _, msg := range msgs {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		learner.Add(seq, msg)
+	}
+
+	// only 2 of the 4 messages with the same signature are kept, but all are counted
+	require.Equal(t, 5, learner.Len())
+	require.Len(t, learner.groups[learner.sigs[0]].msgs, 2)
+
+	cands, err := learner.Learn(0)
+	require.NoError(t, err)
+	require.Len(t, cands, 2)
+	require.Equal(t, 4, cands[0].Count)
+	require.Equal(t, msgs[:2], cands[0].Examples)
+	require.Equal(t, 1, cands[1].Count)
+
+	cands, err = learner.Learn(4)
+	require.NoError(t, err)
+	require.Len(t, cands, 2)
+	require.NotEqual(t, "", cands[1].ID)
+	require.Equal(t, 1, learner.Len())
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LintSeverity is how serious a problem found by Lint is.
+type LintSeverity int
+
+const (
+	// LintWarning is a pattern that's loaded, but probably doesn't do what's
+	// intended, e.g., one that no message can match.
+	LintWarning LintSeverity = iota
+
+	// LintError is a pattern that can't be loaded.
+	LintError
+)
+
+func (this LintSeverity) String() string {
+	if this == LintError {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// LintIssue is a problem with a pattern, at the file and line it's written.
+type LintIssue struct {
+	File     string
+	Line     int
+	Severity LintSeverity
+	Message  string
+}
+
+func (this LintIssue) String() string {
+	if this.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", this.File, this.Severity, this.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %s", this.File, this.Line, this.Severity, this.Message)
+}
+
+// LintFiles reads the pattern files, as a single set, the same way they are loaded
+// into a parser, and returns the problems Lint finds with them. A file that can't
+// be read is reported as an error as well.
+func LintFiles(files []string) []LintIssue {
+	var (
+		defs   []PatternDef
+		issues []LintIssue
+	)
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			issues = append(issues, LintIssue{File: file, Severity: LintError, Message: err.Error()})
+			continue
+		}
+
+		d, err := ReadPatterns(f, file)
+		f.Close()
+
+		if perr, ok := err.(*PatternError); ok {
+			issues = append(issues, LintIssue{File: perr.File, Line: perr.Line, Severity: LintError, Message: perr.Err.Error()})
+		} else if err != nil {
+			issues = append(issues, LintIssue{File: file, Severity: LintError, Message: err.Error()})
+		}
+
+		defs = append(defs, d...)
+	}
+
+	return append(issues, Lint(defs)...)
+}
+
+// Lint adds the patterns to a parser, in order, and returns the problems with
+// them, in the order of the patterns. The errors are
+//
+//   - patterns the scanner or Parser.Add fails on, e.g., with an unknown %tag%
+//
+// and the warnings are
+//
+//   - words that look like a %tag%, but are matched as literals, e.g., %srcip
+//   - patterns that are the same as one before them, in the same or another file
+//   - patterns that only have %string% tokens, and punctuation, which match
+//     almost any message with the same number of tokens
+//   - patterns that are shadowed by another pattern, so even a message written
+//     for the pattern, with the values its tokens and constraints expect, is
+//     matched by the other one
+func Lint(defs []PatternDef) []LintIssue {
+	type lintPattern struct {
+		def int
+		seq Sequence
+		id  string
+	}
+
+	var (
+		parser   = NewParser()
+		ids      = make(map[string]int)
+		patterns []lintPattern
+
+		// issues of each of the patterns
+		found = make([][]LintIssue, len(defs))
+	)
+
+	issue := func(i int, severity LintSeverity, format string, args ...interface{}) {
+		found[i] = append(found[i], LintIssue{File: defs[i].File, Line: defs[i].Line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for i, def := range defs {
+		seq, err := DefaultScanner.Tokenize(def.Pattern, nil)
+		if err != nil {
+			issue(i, LintError, "%s", err)
+			continue
+		}
+
+		for _, token := range seq {
+			if token.Type == TokenLiteral && len(token.Value) > 1 && (token.Value[0] == '%' || token.Value[len(token.Value)-1] == '%') {
+				if pt, err := newPatternToken(token); err == nil && pt.Type == TokenLiteral && pt.cons == nil {
+					issue(i, LintWarning, "%s looks like a tag, but is matched as a literal", token.Value)
+				}
+			}
+		}
+
+		if err := parser.Add(seq); err != nil {
+			issue(i, LintError, "%s", strings.TrimPrefix(err.Error(), "sequence: "))
+			continue
+		}
+
+		id := PatternID(AsPattern(seq))
+		if j, ok := ids[id]; ok {
+			issue(i, LintWarning, "duplicate of the pattern at %s:%d", defs[j].File, defs[j].Line)
+			continue
+		}
+
+		ids[id] = i
+		patterns = append(patterns, lintPattern{i, seq, id})
+
+		if isGenericPattern(seq) {
+			issue(i, LintWarning, "only has %%string%% tokens, so it matches almost any message with %d tokens", len(seq))
+		}
+	}
+
+	for _, p := range patterns {
+		_, id, err := parser.ParsePattern(lintMessage(p.seq))
+
+		if err != nil {
+			issue(p.def, LintWarning, "unreachable, no message matches it")
+		} else if id != p.id {
+			j := ids[id]
+			issue(p.def, LintWarning, "shadowed by the pattern at %s:%d", defs[j].File, defs[j].Line)
+		}
+	}
+
+	var issues []LintIssue
+
+	for _, f := range found {
+		issues = append(issues, f...)
+	}
+
+	return issues
+}
+
+// isGenericPattern returns true if the pattern only has %string% tokens, other
+// than punctuation.
+func isGenericPattern(seq Sequence) bool {
+	var n int
+
+	for _, token := range seq {
+		pt, err := newPatternToken(token)
+		if err != nil {
+			return false
+		}
+
+		switch {
+		case pt.Type == TokenString && pt.Field == FieldUnknown && pt.cons == nil:
+			n++
+
+		case pt.Type == TokenLiteral && pt.cons == nil && len(pt.Value) == 1 && !isLetter(rune(pt.Value[0])) && (pt.Value[0] < '0' || pt.Value[0] > '9'):
+
+		default:
+			return false
+		}
+	}
+
+	return n > 0
+}
+
+// lintMessage returns a message sequence written for the pattern, with the types
+// its tokens expect, and values that satisfy their constraints. Repeated tokens
+// are written the least number of times they can be, but at least once.
+func lintMessage(seq Sequence) Sequence {
+	var msg Sequence
+
+	for _, token := range seq {
+		pt, err := newPatternToken(token)
+		if err != nil {
+			continue
+		}
+
+		if pt.Type == TokenLiteral && pt.cons == nil {
+			msg = append(msg, Token{Type: TokenLiteral, Value: pt.Value})
+			continue
+		}
+
+		var v string
+		if pt.cons != nil {
+			v = pt.cons.sample()
+		}
+
+		n := pt.min
+		if n == 0 {
+			n = 1
+		}
+
+		for i := 0; i < n; i++ {
+			msg = append(msg, Token{Type: pt.Type, Value: v})
+		}
+	}
+
+	return msg
+}
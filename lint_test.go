@@ -0,0 +1,53 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	defs, err := ReadPatterns(strings.NewReader(`
+%msgtime% %apphost% sshd : accepted password for %dstuser% from %srcipv4%
+%msgtime% %apphost% sshd : accepted password for %srcuser% from %srcipv4%
+%msgtime% %apphost% sshd : %action:accepted|failed% password for %dstuser% from %srcipv4:10.0.0.0/8%
+%msgtime% %apphost% sshd : failed password for %nosuchfield% from %srcipv4%
+%msgtime% %apphost% sshd : session opened for %srcip
+%string% : %string% %string%
+`), "a.txt")
+	require.NoError(t, err)
+
+	more, err := ReadPatterns(strings.NewReader(`
+%msgtime%   %apphost% sshd : accepted password for %dstuser% from %srcipv4%
+%msgtime% %apphost% sshd : %string{2}% password for %dstuser% from %srcipv4%
+`), "b.txt")
+	require.NoError(t, err)
+
+	var issues []string
+	for _, issue := range Lint(append(defs, more...)) {
+		issues = append(issues, issue.String())
+	}
+
+	require.Equal(t, []string{
+		"a.txt:2: warning: shadowed by the pattern at a.txt:3",
+		"a.txt:5: error: unknown field or token type %nosuchfield%",
+		"a.txt:6: warning: %srcip looks like a tag, but is matched as a literal",
+		"a.txt:7: warning: only has %string% tokens, so it matches almost any message with 4 tokens",
+		"b.txt:2: warning: duplicate of the pattern at a.txt:2",
+	}, issues)
+}
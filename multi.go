@@ -0,0 +1,131 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import "strings"
+
+// These are the names of the formats recognized by the MultiScanner returned
+// from NewMultiScanner.
+const (
+	FormatGeneral = "general"
+	FormatJSON    = "json"
+	FormatCEF     = "cef"
+	FormatKV      = "kv"
+)
+
+// MultiScanner inspects each message, and dispatches it to the Scanner for the
+// format of the message. The format is detected by cheaply sniffing the prefix and
+// the shape of the message, without fully parsing it. Formats are checked in the
+// order they are added, and if none of them match, the Default scanner is used.
+type MultiScanner struct {
+	// Default is the Scanner used for messages that don't match any format
+	Default Scanner
+
+	formats []scannerFormat
+}
+
+type scannerFormat struct {
+	name    string
+	sniff   func(s string) bool
+	scanner Scanner
+}
+
+var _ Scanner = (*MultiScanner)(nil)
+
+// NewMultiScanner returns a MultiScanner that recognizes JSON, CEF and key=value
+// messages, and uses the DefaultScanner for everything else.
+func NewMultiScanner() *MultiScanner {
+	this := &MultiScanner{
+		Default: DefaultScanner,
+	}
+
+	this.Add(FormatJSON, IsJSON, &JSONScanner{})
+	this.Add(FormatCEF, IsCEF, &CEFScanner{})
+	this.Add(FormatKV, IsKV, &KVScanner{})
+
+	return this
+}
+
+// Add adds a format with the function that detects it, and the Scanner that will
+// tokenize the messages of this format.
+func (this *MultiScanner) Add(name string, sniff func(s string) bool, scanner Scanner) {
+	this.formats = append(this.formats, scannerFormat{name, sniff, scanner})
+}
+
+// Formats returns the names of all the formats, in the order they are checked.
+// FormatGeneral, the format of the Default scanner, is always the last.
+func (this *MultiScanner) Formats() []string {
+	names := make([]string, 0, len(this.formats)+1)
+	for _, f := range this.formats {
+		names = append(names, f.name)
+	}
+
+	return append(names, FormatGeneral)
+}
+
+// Tokenize returns a Sequence, or a list of tokens, for the data string supplied.
+func (this *MultiScanner) Tokenize(s string, seq Sequence) (Sequence, error) {
+	seq, _, err := this.TokenizeFormat(s, seq)
+	return seq, err
+}
+
+// TokenizeFormat returns a Sequence for the data string supplied, as well as the
+// name of the format, and thus the Scanner, that was used to tokenize it. If the
+// Scanner for the detected format fails, the message is tokenized by the Default
+// scanner, and the format returned is FormatGeneral.
+func (this *MultiScanner) TokenizeFormat(s string, seq Sequence) (Sequence, string, error) {
+	for _, f := range this.formats {
+		if f.sniff(s) {
+			if res, err := f.scanner.Tokenize(s, seq[:0]); err == nil {
+				return res, f.name, nil
+			}
+
+			break
+		}
+	}
+
+	seq, err := this.Default.Tokenize(s, seq[:0])
+	return seq, FormatGeneral, err
+}
+
+// IsJSON returns true if the message looks like a JSON object.
+func IsJSON(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) >= 2 && s[0] == '{' && s[len(s)-1] == '}'
+}
+
+// IsCEF returns true if the message contains a CEF header, "CEF:" followed by a
+// version and at least 7 "|" separators, either at the beginning of the message,
+// or after a syslog header.
+func IsCEF(s string) bool {
+	i := strings.Index(s, "CEF:")
+	return i >= 0 && i+4 < len(s) && s[i+4] >= '0' && s[i+4] <= '9' && strings.Count(s[i:], "|") >= 7
+}
+
+// IsKV returns true if the message has at least 3 key=value pairs, and at least
+// a third of the space separated words in the message are pairs.
+func IsKV(s string) bool {
+	var pairs, words int
+
+	for _, w := range strings.Fields(s) {
+		words++
+
+		if i := strings.IndexByte(w, '='); i > 0 && isKeyChar(w[i-1]) && isKeyChar(w[0]) {
+			pairs++
+		}
+	}
+
+	return pairs >= 3 && pairs*3 >= words
+}
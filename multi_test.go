@@ -0,0 +1,146 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	multitests = []struct {
+		data   string
+		format string
+		seq    Sequence
+	}{
+		{
+			"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2",
+			FormatGeneral,
+			nil,
+		},
+		{
+			`{"user":{"name":"bob","id":1001},"src":"10.1.2.3","tags":["a","b c"],"ok":true}`,
+			FormatJSON,
+			Sequence{
+				Token{Type: TokenLiteral, Value: "user.name", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "bob", isValue: true},
+				Token{Type: TokenLiteral, Value: "user.id", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenInteger, Value: "1001", isValue: true},
+				Token{Type: TokenLiteral, Value: "src", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenIPv4, Value: "10.1.2.3", isValue: true},
+				Token{Type: TokenLiteral, Value: "tags.0", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "a", isValue: true},
+				Token{Type: TokenLiteral, Value: "tags.1", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "b c", isValue: true},
+				Token{Type: TokenLiteral, Value: "ok", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "true", isValue: true},
+			},
+		},
+		{
+			"Sep 19 08:26:10 host CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 msg=stopped the worm spt=1232",
+			FormatCEF,
+			Sequence{
+				Token{Type: TokenTime, Value: "Sep 19 08:26:10"},
+				Token{Type: TokenLiteral, Value: "host"},
+				Token{Type: TokenLiteral, Value: "CEF"},
+				Token{Type: TokenLiteral, Value: ":"},
+				Token{Type: TokenInteger, Value: "0"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenString, Value: "Security"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenString, Value: "threatmanager"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenFloat, Value: "1.0"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenInteger, Value: "100"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenString, Value: "worm successfully stopped"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenInteger, Value: "10"},
+				Token{Type: TokenLiteral, Value: "|"},
+				Token{Type: TokenLiteral, Value: "src", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenIPv4, Value: "10.0.0.1", isValue: true},
+				Token{Type: TokenLiteral, Value: "dst", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenIPv4, Value: "2.1.2.2", isValue: true},
+				Token{Type: TokenLiteral, Value: "msg", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "stopped the worm", isValue: true},
+				Token{Type: TokenLiteral, Value: "spt", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenInteger, Value: "1232", isValue: true},
+			},
+		},
+		{
+			"id=firewall time=\"2005-03-18 14:01:43\" fw=TOPSEC priv=4 op=\"to 1 recips\" ruser= rule=deny,",
+			FormatKV,
+			Sequence{
+				Token{Type: TokenLiteral, Value: "id", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "firewall", isValue: true},
+				Token{Type: TokenLiteral, Value: "time", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenTime, Value: "2005-03-18 14:01:43", isValue: true},
+				Token{Type: TokenLiteral, Value: "fw", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "TOPSEC", isValue: true},
+				Token{Type: TokenLiteral, Value: "priv", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenInteger, Value: "4", isValue: true},
+				Token{Type: TokenLiteral, Value: "op", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "to 1 recips", isValue: true},
+				Token{Type: TokenLiteral, Value: "ruser", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenLiteral, Value: "rule", isKey: true},
+				Token{Type: TokenLiteral, Value: "="},
+				Token{Type: TokenString, Value: "deny", isValue: true},
+			},
+		},
+	}
+)
+
+func TestMultiScannerTokenize(t *testing.T) {
+	scanner := NewMultiScanner()
+	seq := make(Sequence, 0, 20)
+
+	for _, tc := range multitests {
+		seq, format, err := scanner.TokenizeFormat(tc.data, seq)
+		require.NoError(t, err)
+		require.Equal(t, tc.format, format, tc.data)
+
+		if tc.seq != nil {
+			require.Equal(t, tc.seq, seq, tc.data+"\n"+seq.PrintTokens())
+		}
+	}
+}
+
+func TestMultiScannerFallback(t *testing.T) {
+	scanner := NewMultiScanner()
+
+	// Looks like JSON, but isn't, so it's handled by the default scanner
+	seq, format, err := scanner.TokenizeFormat(`{"user": bob}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, FormatGeneral, format)
+	require.NotEmpty(t, seq)
+}
@@ -15,7 +15,10 @@
 package sequence
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -28,15 +31,30 @@ type Parser struct {
 	root   *parseNode
 	height int
 	mu     sync.RWMutex
+
+	// patterns that have been added, keyed by their IDs, and the IDs in the order
+	// the patterns are added, so the tree can be rebuilt when patterns are removed
+	patterns map[string]Sequence
+	ids      []string
 }
 
 type parseNode struct {
 	Token
 
 	leaf, // is this a leaf?
+	more, // does this loop back to itself, for one or more tokens?
 	rest, // absorb the rest of the string?
 	parent bool // is this parent, or does this have child(ren)?
 
+	// the most tokens a rest node absorbs, 0 if there's no limit
+	limit int
+
+	// the values the node matches, nil if it matches any value of its type
+	cons *constraint
+
+	// ID of the pattern that ends at this node, if it's a leaf
+	id string
+
 	// token types children
 	tc [TokenTypesCount][]*parseNode
 
@@ -57,11 +75,59 @@ func (this stackParseNode) String() string {
 
 func NewParser() *Parser {
 	return &Parser{
-		root:   newParseNode(),
-		height: 0,
+		root:     newParseNode(),
+		height:   0,
+		patterns: make(map[string]Sequence),
 	}
 }
 
+// looseTypes are the other token types that a token type also matches, as a
+// partial match, e.g., a plain integer is taken as a number of bytes or seconds.
+var looseTypes = map[TokenType][]TokenType{
+	TokenInteger: {TokenDuration, TokenBytes},
+	TokenFloat:   {TokenDuration},
+}
+
+// looseType returns true if a token of type ttype matches a node of type ntype,
+// either because they are the same type, or ntype is one of the looseTypes.
+func looseType(ntype, ttype TokenType) bool {
+	if ntype == ttype {
+		return true
+	}
+
+	for _, t := range looseTypes[ttype] {
+		if t == ntype {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PatternID returns the ID of the pattern sequence. The ID is derived from the
+// pattern itself, so the same pattern always has the same ID, regardless of which
+// parser it's added to.
+func PatternID(seq Sequence) string {
+	sum := sha1.Sum([]byte(strings.ToLower(seq.String())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// AsPattern returns a copy of the pattern sequence as it's added to a parser, with
+// the host names, email addresses, UUIDs, hashes and paths that are written out in
+// the pattern changed to literals. The ID of the pattern in the parser is the
+// PatternID of the sequence returned.
+func AsPattern(seq Sequence) Sequence {
+	seq = append(Sequence(nil), seq...)
+
+	for i, token := range seq {
+		if token.Field == FieldUnknown && isLiteralShape(token.Type) {
+			seq[i].Type = TokenLiteral
+		}
+	}
+
+	return seq
+}
+
 func newParseNode() *parseNode {
 	return &parseNode{
 		lc: make(map[string]*parseNode),
@@ -73,97 +139,387 @@ func (this *parseNode) String() string {
 }
 
 // Add will add a single pattern sequence to the parser tree. This effectively
-// builds the parser tree so it can be used for parsing later.
+// builds the parser tree so it can be used for parsing later. Adding a pattern
+// that's already in the parser does nothing. A %tag% in the pattern that's not a
+// known field or token type, including the registered fields, is an error. So is
+// an invalid repetition at the end of a %tag%, e.g., %string{3,1}%.
+//
+// Host names, email addresses, UUIDs, hashes and paths that are written out in
+// the pattern, e.g., /etc/passwd, are matched as is, so their tokens are changed
+// to literals in the parser's copy of the pattern, as returned by AsPattern. The
+// sequence supplied is not changed. Use %host%, %path%, etc, to match any value.
 //func (this *Parser) Add(s string) error {
 func (this *Parser) Add(seq Sequence) error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
-	cur := this.root
+	seq = AsPattern(seq)
 
-	for _, token := range seq {
-		vl := len(token.Value)
-		more, rest := false, false
+	id := PatternID(seq)
+	if _, ok := this.patterns[id]; ok {
+		return nil
+	}
 
-		if vl >= 2 && token.Value[0] == '%' && token.Value[vl-1] == '%' {
-			switch token.Value[vl-2] {
-			case metaMore:
-				token.Value = token.Value[:vl-2] + "%"
-				more = true
-			case metaRest:
-				token.Value = token.Value[:vl-2] + "%"
-				rest = true
-			}
+	if err := this.add(seq, id); err != nil {
+		return err
+	}
 
-			if f := name2FieldType(token.Value); f != FieldUnknown {
-				token.Field = f
-				token.Type = f.TokenType()
-			} else if t := name2TokenType(token.Value); t != TokenUnknown {
-				token.Type = t
-				token.Field = FieldUnknown
-			}
+	this.patterns[id] = seq
+	this.ids = append(this.ids, id)
+
+	return nil
+}
+
+// Remove removes the pattern with the ID from the parser. The parser tree is
+// rebuilt with the remaining patterns.
+func (this *Parser) Remove(id string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, ok := this.patterns[id]; !ok {
+		return ErrNoPattern
+	}
+
+	delete(this.patterns, id)
+
+	for i, pid := range this.ids {
+		if pid == id {
+			this.ids = append(this.ids[:i], this.ids[i+1:]...)
+			break
+		}
+	}
+
+	this.root = newParseNode()
+	this.height = 0
+
+	for _, pid := range this.ids {
+		if err := this.add(this.patterns[pid], pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Pattern returns the pattern sequence with the ID.
+func (this *Parser) Pattern(id string) (Sequence, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	seq, ok := this.patterns[id]
+	if !ok {
+		return nil, ErrNoPattern
+	}
+
+	return append(Sequence(nil), seq...), nil
+}
+
+// Patterns returns the IDs of all the patterns in the parser, in the order they
+// are added.
+func (this *Parser) Patterns() []string {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return append([]string(nil), this.ids...)
+}
+
+// MaxRepeat is the largest upper bound of a repetition in a pattern, e.g., the 5
+// in %string{1,5}%. Each number of times the token can be repeated is a separate
+// branch of the parser, so larger bounds are an error, and %string{1,}% should be
+// used instead.
+var MaxRepeat = 20
+
+// maxBranches is the most branches a pattern can be added as, since the branches
+// of the repeated tokens in a pattern multiply.
+const maxBranches = 1000
+
+// patternToken is a token of a pattern, with the number of message tokens it
+// matches, from min to max, where max is -1 if there's no upper bound. A rest
+// token absorbs the rest of the message, up to max tokens, or all of them if max
+// is 0. If there's a constraint, the values the token matches must satisfy it.
+type patternToken struct {
+	Token
+
+	min, max int
+	rest     bool
+	cons     *constraint
+}
+
+// newPatternToken returns the pattern token for the token. A %tag% is turned into
+// its field or token type, and the meta at the end of the tag, or in Meta, into
+// the repetition, e.g.,
+//
+//   %string%       one token
+//   %string?%      zero or one token
+//   %string+%      one or more tokens
+//   %string{3}%    three tokens
+//   %string{1,5}%  one to five tokens
+//   %string{2,}%   two or more tokens
+//   %string-%      the rest of the message, as a single value
+//   %string-10%    the rest of the message, if it's no more than ten tokens
+//
+// where the upper bound is at most MaxRepeat, and the constraint that follows a
+// colon, e.g., %srcport?:1-1023%, see constraint for what it can be.
+func newPatternToken(token Token) (patternToken, error) {
+	meta := token.Meta
+
+	if vl := len(token.Value); vl >= 2 && token.Value[0] == '%' && token.Value[vl-1] == '%' {
+		name, m := splitMeta(token.Value)
+
+		if f := name2FieldType(name); f != FieldUnknown {
+			token.Field = f
+			token.Type = f.TokenType()
+		} else if t := name2TokenType(name); t != TokenUnknown {
+			token.Type = t
+			token.Field = FieldUnknown
+		} else if vl > 2 {
+			return patternToken{}, fmt.Errorf("sequence: unknown field or token type %s", token.Value)
+		}
+
+		// %literal% is matched as is, but %literal:tcp|udp% are the alternatives,
+		// and a literal can't be repeated, e.g., %literal+%
+		if token.Type == TokenLiteral && m != "" && strings.IndexByte(m, ':') < 0 {
+			return patternToken{}, fmt.Errorf("sequence: literal %s can't be repeated", token.Value)
+		}
+
+		if token.Type != TokenLiteral || strings.IndexByte(m, ':') >= 0 {
+			token.Value, meta = name, m
+		}
+	}
+
+	token.Meta = meta
+	pt := patternToken{Token: token, min: 1, max: 1}
+
+	if meta == "" {
+		return pt, nil
+	}
+
+	rep := meta
+
+	if i := strings.IndexByte(meta, ':'); i >= 0 {
+		if token.Type == TokenUnknown {
+			return patternToken{}, fmt.Errorf("sequence: unknown token %s can't be constrained", token.Value)
+		}
+
+		var err error
+		if pt.cons, err = newConstraint(token.Type, meta[i+1:]); err != nil {
+			return patternToken{}, err
+		}
+
+		rep = meta[:i]
+	}
+
+	if rep == "" {
+		return pt, nil
+	}
+
+	if token.Type == TokenUnknown || token.Type == TokenLiteral {
+		return patternToken{}, fmt.Errorf("sequence: literal %s can't be repeated", token.Value)
+	}
+
+	var ok bool
+	if pt.min, pt.max, pt.rest, ok = parseMeta(rep); !ok {
+		return patternToken{}, fmt.Errorf("sequence: invalid repetition %s for %s", rep, token.Value)
+	}
+
+	if !pt.rest && pt.max > MaxRepeat {
+		return patternToken{}, fmt.Errorf("sequence: repetition %s for %s is more than %d", rep, token.Value, MaxRepeat)
+	}
+
+	return pt, nil
+}
+
+// splitMeta splits the %tag% into the %name% and the meta, e.g., %string{1,5}%
+// into %string% and {1,5}.
+func splitMeta(tag string) (string, string) {
+	i := 1
+	for ; i < len(tag)-1; i++ {
+		if c := tag[i]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.') {
+			break
 		}
+	}
 
-		var found *parseNode
+	return tag[:i] + "%", tag[i : len(tag)-1]
+}
+
+// parseMeta returns the repetition for the meta of a %tag%, see newPatternToken.
+func parseMeta(meta string) (min, max int, rest, ok bool) {
+	switch {
+	case meta == "":
+		return 1, 1, false, true
+
+	case meta[0] == metaOptional && len(meta) == 1:
+		return 0, 1, false, true
+
+	case meta[0] == metaMore && len(meta) == 1:
+		return 1, -1, false, true
+
+	case meta[0] == metaRest:
+		if len(meta) == 1 {
+			return 1, 0, true, true
+		}
+
+		n, err := strconv.Atoi(meta[1:])
+		return 1, n, true, err == nil && n > 0 && meta[1] != '+'
+
+	case meta[0] == metaRepeat && meta[len(meta)-1] == '}':
+		parts := strings.Split(meta[1:len(meta)-1], ",")
+		if len(parts) > 2 {
+			return 0, 0, false, false
+		}
+
+		var err error
+		if min, err = strconv.Atoi(parts[0]); err != nil || min < 0 {
+			return 0, 0, false, false
+		}
 
 		switch {
-		case token.Type != TokenUnknown && token.Type != TokenLiteral:
-			// token nodes
-			if cur.tc[token.Type] != nil {
-				for _, n := range cur.tc[token.Type] {
-					if n.Type == token.Type && n.Field == token.Field {
-						found = n
-						break
-					}
-				}
+		case len(parts) == 1:
+			max = min
+		case parts[1] == "":
+			max = -1
+		default:
+			if max, err = strconv.Atoi(parts[1]); err != nil {
+				return 0, 0, false, false
 			}
+		}
 
-			if found == nil {
-				found = newParseNode()
-				found.Token = token
-				cur.tc[token.Type] = append(cur.tc[token.Type], found)
-				cur.parent = true
-			}
+		return min, max, false, max < 0 || max >= min && max > 0
+	}
+
+	return 0, 0, false, false
+}
+
+func (this *Parser) add(seq Sequence, id string) error {
+	toks := make([]patternToken, 0, len(seq))
+	branches := 1
+
+	for i, token := range seq {
+		pt, err := newPatternToken(token)
+		if err != nil {
+			return err
+		}
 
-			if more {
-				found.tc[token.Type] = append(found.tc[token.Type], found)
-				found.parent = true
+		if pt.rest && i < len(seq)-1 {
+			return fmt.Errorf("sequence: %s is not the last token of the pattern", token.Value)
+		}
+
+		if !pt.rest && pt.max > pt.min {
+			if branches *= pt.max - pt.min + 1; branches > maxBranches {
+				return fmt.Errorf("sequence: pattern has too many repeated tokens, more than %d branches", maxBranches)
 			}
+		}
+
+		toks = append(toks, pt)
+	}
+
+	this.insert(this.root, toks, 0, id)
+
+	return nil
+}
+
+// insert adds the pattern tokens to the tree under cur. Tokens that are repeated
+// or optional are added once for each number of times they can be repeated, so
+// each of these branches ends with a leaf for the pattern.
+func (this *Parser) insert(cur *parseNode, toks []patternToken, depth int, id string) {
+	if len(toks) == 0 {
+		cur.leaf = true
+		if cur.id == "" {
+			cur.id = id
+		}
+
+		//fmt.Printf("parser.go/AddPattern(): count = %d, height = %d\n", msg.Count(), this.height)
+		if depth >= this.height {
+			this.height = depth + 1
+		}
+
+		return
+	}
+
+	pt := toks[0]
 
-			if rest {
-				found.rest = rest
+	switch {
+	case pt.rest:
+		this.insert(cur.child(pt, false), toks[1:], depth+1, id)
+
+	case pt.Type != TokenUnknown && (pt.Type != TokenLiteral || pt.cons != nil):
+		// %string+% is added as a node that loops back to itself, and %string{2,}%
+		// as a %string% node followed by the looping one
+		min, max := pt.min, pt.max
+		if max < 0 {
+			if max = min; max == 0 {
+				max = 1
 			}
+		}
+
+		for n := min; n <= max; n++ {
+			found := cur
 
-		case token.Type == TokenLiteral:
-			var ok bool
-			v := strings.ToLower(token.Value)
-			if found, ok = cur.lc[v]; !ok {
-				found = newParseNode()
-				found.Token = token
-				found.Value = v
-				cur.lc[v] = found
-				cur.parent = true
+			for i := 0; i < n; i++ {
+				found = found.child(pt, pt.max < 0 && i == n-1)
 			}
+
+			this.insert(found, toks[1:], depth+n, id)
 		}
 
-		//glog.Debugf("Added %s", found)
-		cur = found
+	default:
+		v := strings.ToLower(pt.Value)
+
+		found, ok := cur.lc[v]
+		if !ok {
+			found = newParseNode()
+			found.Token = pt.Token
+			found.Value = v
+			cur.lc[v] = found
+			cur.parent = true
+		}
+
+		this.insert(found, toks[1:], depth+1, id)
 	}
+}
 
-	cur.leaf = true
+// child returns the child of the node for the pattern token, with the same field,
+// token type, repetition and constraint, or a new one if there's none. more is
+// true for a child that loops back to itself.
+func (this *parseNode) child(pt patternToken, more bool) *parseNode {
+	token := pt.Token
 
-	//fmt.Printf("parser.go/AddPattern(): count = %d, height = %d\n", msg.Count(), this.height)
-	if len(seq) > this.height {
-		this.height = len(seq) + 1
+	var limit int
+	if pt.rest {
+		limit = pt.max
 	}
 
-	return nil
+	for _, n := range this.tc[token.Type] {
+		if n.Type == token.Type && n.Field == token.Field && n.more == more && n.rest == pt.rest && n.limit == limit && n.cons.String() == pt.cons.String() {
+			return n
+		}
+	}
+
+	found := newParseNode()
+	found.Token = Token{Type: token.Type, Field: token.Field, Value: token.Value}
+	found.more, found.rest, found.limit, found.cons = more, pt.rest, limit, pt.cons
+	this.tc[token.Type] = append(this.tc[token.Type], found)
+	this.parent = true
+
+	if more {
+		found.tc[token.Type] = append(found.tc[token.Type], found)
+		found.parent = true
+	}
+
+	return found
 }
 
 // Parse will take the message sequence supplied and go through the parser tree to
 // find the matching pattern sequence. If found, the pattern sequence is returned.
 //func (this *Parser) Parse(s string) (Sequence, error) {
 func (this *Parser) Parse(seq Sequence) (Sequence, error) {
+	seq, _, err := this.ParsePattern(seq)
+	return seq, err
+}
+
+// ParsePattern is the same as Parse, except it also returns the ID of the pattern
+// that matched the message.
+func (this *Parser) ParsePattern(seq Sequence) (Sequence, string, error) {
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 
@@ -183,6 +539,7 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 
 		bestScore int
 		bestPath  = make(Sequence, len(seq))
+		bestID    string
 	)
 
 	// toVisit is a stack, children that need to be visited are appended to the end,
@@ -210,6 +567,10 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 
 		if cur.node.leaf {
 			if cur.node.rest {
+				if cur.node.limit > 0 && len(seq)-cur.level+1 > cur.node.limit {
+					continue
+				}
+
 				l := len(path) - 1
 				for i := cur.level; i < len(seq); i++ {
 					path[l].Value += " " + seq[i].Value
@@ -223,6 +584,7 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				if cur.score > bestScore {
 					bestScore = cur.score
 					bestPath = append(bestPath[:0], path...)
+					bestID = cur.node.id
 				}
 
 				continue
@@ -244,25 +606,58 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 
 		switch token.Type {
 		case TokenLiteral:
-			for _, n := range cur.node.tc[TokenString] {
-				toVisit = append(toVisit, stackParseNode{n, cur.level + 1, cur.score + partialMatchWeight, token.Value})
-			}
+			toVisit = visitNodes(toVisit, cur.node.tc[TokenString], cur, partialMatchWeight, token.Value)
+
+			// %literal:a|b% alternatives are full matches, just like the literals
+			toVisit = visitNodes(toVisit, cur.node.tc[TokenLiteral], cur, fullMatchWeight, token.Value)
 
 			// If the values match, then it's a full match, add it to the stack
 			if n, ok := cur.node.lc[token.Value]; ok {
 				toVisit = append(toVisit, stackParseNode{n, cur.level + 1, cur.score + fullMatchWeight, token.Value})
 			}
 
-		default:
-			for _, n := range cur.node.tc[token.Type] {
+		case TokenHost, TokenEmail, TokenUUID, TokenHash, TokenPath, TokenDuration, TokenBytes, TokenPercent:
+			toVisit = visitNodes(toVisit, cur.node.tc[TokenString], cur, partialMatchWeight, token.Value)
+			toVisit = visitNodes(toVisit, cur.node.tc[token.Type], cur, fullMatchWeight, token.Value)
+			toVisit = visitNodes(toVisit, cur.node.tc[TokenLiteral], cur, fullMatchWeight, token.Value)
+
+			// A host name, path, etc, that's written out in the pattern is added
+			// last, so it's visited first, and wins over the same type
+			if n, ok := cur.node.lc[strings.ToLower(token.Value)]; ok {
 				toVisit = append(toVisit, stackParseNode{n, cur.level + 1, cur.score + fullMatchWeight, token.Value})
 			}
+
+		default:
+			for _, t := range looseTypes[token.Type] {
+				toVisit = visitNodes(toVisit, cur.node.tc[t], cur, partialMatchWeight, token.Value)
+			}
+
+			toVisit = visitNodes(toVisit, cur.node.tc[token.Type], cur, fullMatchWeight, token.Value)
 		}
 	}
 
 	if bestScore > 0 {
-		return bestPath, nil
+		return bestPath, bestID, nil
+	}
+
+	return nil, "", ErrNoMatch
+}
+
+// visitNodes adds the child nodes of cur that the value satisfies the constraints
+// of to the toVisit stack, with the weight added to the score. The constrained
+// nodes are added last, so they are visited first, and win over the others.
+func visitNodes(toVisit []stackParseNode, nodes []*parseNode, cur stackParseNode, weight int, value string) []stackParseNode {
+	for _, n := range nodes {
+		if n.cons == nil {
+			toVisit = append(toVisit, stackParseNode{n, cur.level + 1, cur.score + weight, value})
+		}
+	}
+
+	for _, n := range nodes {
+		if n.cons != nil && n.cons.match(value) {
+			toVisit = append(toVisit, stackParseNode{n, cur.level + 1, cur.score + weight, value})
+		}
 	}
 
-	return nil, ErrNoMatch
+	return toVisit
 }
@@ -135,3 +135,220 @@ func TestParserParseMessages(t *testing.T) {
 		//glog.Debugln(seq.PrintTokens())
 	}
 }
+
+func TestParserPatternIDs(t *testing.T) {
+	parser := NewParser()
+	seq := make(Sequence, 0, 20)
+
+	var ids []string
+
+	for _, tc := range parsetests {
+		seq = seq[:0]
+		seq, err := DefaultScanner.Tokenize(tc.rule, seq)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq), tc.rule)
+		ids = append(ids, PatternID(seq))
+	}
+
+	require.Equal(t, ids, parser.Patterns())
+
+	for i, tc := range parsetests {
+		seq = seq[:0]
+		seq, err := DefaultScanner.Tokenize(tc.msg, seq)
+		require.NoError(t, err)
+		_, id, err := parser.ParsePattern(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, ids[i], id, tc.msg)
+	}
+
+	pat, err := parser.Pattern(ids[0])
+	require.NoError(t, err)
+	require.Equal(t, parsetests[0].rule, pat.String())
+
+	require.NoError(t, parser.Remove(ids[0]))
+	require.Equal(t, ErrNoPattern, parser.Remove(ids[0]))
+	require.Equal(t, ids[1:], parser.Patterns())
+
+	seq = seq[:0]
+	seq, err = DefaultScanner.Tokenize(parsetests[0].msg, seq)
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.Equal(t, ErrNoMatch, err)
+
+	seq = seq[:0]
+	seq, err = DefaultScanner.Tokenize(parsetests[1].msg, seq)
+	require.NoError(t, err)
+	_, id, err := parser.ParsePattern(seq)
+	require.NoError(t, err)
+	require.Equal(t, ids[1], id)
+}
+
+func TestParserLiteralShapes(t *testing.T) {
+	parser := NewParser()
+
+	for _, rule := range []string{
+		"login from %host% by %email%",
+		"login from %srchost% by %srcuser%",
+		"open %path% as %uuid% sum %hash%",
+		"open /etc/passwd as %uuid% sum %hash%",
+	} {
+		seq, err := DefaultScanner.Tokenize(rule, nil)
+		require.NoError(t, err)
+		types := make([]TokenType, len(seq))
+		for i, token := range seq {
+			types[i] = token.Type
+		}
+		require.NoError(t, parser.Add(seq), rule)
+		for i, token := range seq {
+			require.Equal(t, types[i], token.Type, rule)
+		}
+		_, err = parser.Pattern(PatternID(AsPattern(seq)))
+		require.NoError(t, err, rule)
+	}
+
+	for _, tc := range []struct {
+		msg, pat string
+	}{
+		{"login from mail.example.com by root@example.com", "login from %host% by %email%"},
+		{"login from irc by root", "login from %srchost% by %srcuser%"},
+		{"open /var/log/messages as 123e4567-e89b-12d3-a456-426614174000 sum d41d8cd98f00b204e9800998ecf8427e", "open %path% as %uuid% sum %hash%"},
+		{"open /etc/passwd as 123e4567-e89b-12d3-a456-426614174000 sum d41d8cd98f00b204e9800998ecf8427e", "open /etc/passwd as %uuid% sum %hash%"},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		pseq, err := parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pat, pseq.String(), tc.msg)
+	}
+}
+
+func TestParserRepetition(t *testing.T) {
+	parser := NewParser()
+
+	ids := make(map[string]string)
+
+	for _, rule := range []string{
+		"login %srcuser% %string?% from %srcipv4%",
+		"run %string{1,3}% done",
+		"tags %string{2,}% end",
+		"command = %method-3%",
+		"path = %string-%",
+		"ids %integer{0,20}% %string{0,20}% end",
+		"all = %string-100%",
+	} {
+		seq, err := DefaultScanner.Tokenize(rule, nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq), rule)
+		require.Equal(t, rule, seq.String())
+		ids[PatternID(seq)] = rule
+	}
+
+	for _, tc := range []struct {
+		msg, pat string
+		values   []string
+	}{
+		{"login root from 10.1.1.1", "login %srcuser% from %srcipv4%", nil},
+		{"login root again from 10.1.1.1", "login %srcuser% %string% from %srcipv4%", nil},
+		{"login root once again from 10.1.1.1", "", nil},
+		{"run a done", "run %string% done", nil},
+		{"run a b c done", "run %string% %string% %string% done", nil},
+		{"run a b c d done", "", nil},
+		{"run done", "", nil},
+		{"tags a end", "", nil},
+		{"tags a b c end", "tags %string% %string% %string% end", nil},
+		{"command = ls -l /tmp", "command = %method%", []string{"command", "=", "ls -l /tmp"}},
+		{"command = ls -l -a /tmp", "", nil},
+		{"path = a b c d e", "path = %string%", []string{"path", "=", "a b c d e"}},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		pseq, id, err := parser.ParsePattern(seq)
+		if tc.pat == "" {
+			require.Equal(t, ErrNoMatch, err, tc.msg)
+			continue
+		}
+
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pat, pseq.String(), tc.msg)
+		require.Contains(t, ids, id, tc.msg)
+
+		if tc.values != nil {
+			var values []string
+			for _, tok := range pseq {
+				values = append(values, tok.Value)
+			}
+			require.Equal(t, tc.values, values, tc.msg)
+		}
+	}
+
+	for _, rule := range []string{
+		"run %string{3,1}% done",
+		"run %string{0}% done",
+		"run %string{a}% done",
+		"run %string-0% done",
+		"run %string-% done",
+		"run %nosuchfield?% done",
+		"run %string{1,100}% done",
+		"run %literal+% done",
+		"run %literal?% done",
+		"run %literal{2}% done",
+		"run %string{0,20}% %integer{0,20}% %string{0,20}% done",
+	} {
+		seq, err := DefaultScanner.Tokenize(rule, nil)
+		require.NoError(t, err)
+		require.Error(t, parser.Add(seq), rule)
+	}
+}
+
+func TestParserConstraints(t *testing.T) {
+	parser := NewParser()
+
+	for _, rule := range []string{
+		"%action:accepted|failed% password for %dstuser% from %srcipv4:10.0.0.0/8|192.168.1.1% port %srcport:1-1023%",
+		"%action:accepted|failed% password for %dstuser% from %srcipv4% port %srcport%",
+		"connection %literal:tcp|udp% to %dstipv6:fe80::/10%",
+		"connection %string% to %dstipv6%",
+	} {
+		seq, err := DefaultScanner.Tokenize(rule, nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq), rule)
+		require.Equal(t, rule, seq.String())
+	}
+
+	for _, tc := range []struct {
+		msg, pat string
+	}{
+		{"Accepted password for root from 10.1.2.3 port 22", "%action:accepted|failed% password for %dstuser% from %srcipv4:10.0.0.0/8|192.168.1.1% port %srcport:1-1023%"},
+		{"Failed password for root from 192.168.1.1 port 1023", "%action:accepted|failed% password for %dstuser% from %srcipv4:10.0.0.0/8|192.168.1.1% port %srcport:1-1023%"},
+		{"Failed password for root from 192.168.1.2 port 22", "%action:accepted|failed% password for %dstuser% from %srcipv4% port %srcport%"},
+		{"Failed password for root from 10.1.2.3 port 60022", "%action:accepted|failed% password for %dstuser% from %srcipv4% port %srcport%"},
+		{"Rejected password for root from 10.1.2.3 port 22", ""},
+		{"connection UDP to fe80::1", "connection %literal:tcp|udp% to %dstipv6:fe80::/10%"},
+		{"connection sctp to fe80::1", "connection %string% to %dstipv6%"},
+		{"connection tcp to 2001:db8::1", "connection %string% to %dstipv6%"},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		_, id, err := parser.ParsePattern(seq)
+		if tc.pat == "" {
+			require.Equal(t, ErrNoMatch, err, tc.msg)
+			continue
+		}
+
+		require.NoError(t, err, tc.msg)
+		pat, err := parser.Pattern(id)
+		require.NoError(t, err)
+		require.Equal(t, tc.pat, pat.String(), tc.msg)
+	}
+
+	for _, rule := range []string{
+		"port %srcport:1023-1%",
+		"port %srcport:a-b%",
+		"from %srcipv4:10.0.0.0/33%",
+		"is %action:accept||deny%",
+	} {
+		seq, err := DefaultScanner.Tokenize(rule, nil)
+		require.NoError(t, err)
+		require.Error(t, parser.Add(seq), rule)
+	}
+}
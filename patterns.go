@@ -0,0 +1,311 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PatternDef is a single pattern read from a pattern file, along with where it's
+// defined, and the example messages that follow it.
+type PatternDef struct {
+	File     string
+	Line     int
+	Pattern  string
+	Examples []string
+
+	// Expected are the field values expected when the examples are parsed, keyed
+	// by the index of the example, for the examples that are followed by them.
+	Expected map[int]map[string]string
+}
+
+// PatternError is an error in a pattern file, at the line, or in the file as a
+// whole if the line is 0.
+type PatternError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (this *PatternError) Error() string {
+	if this.Line == 0 {
+		return fmt.Sprintf("%s: %s", this.File, this.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", this.File, this.Line, this.Err)
+}
+
+// ReadPatterns reads the patterns from a pattern file. Each line in the file is a
+// pattern, except for
+//
+//   - empty lines, which are skipped
+//   - lines that start with "#", which are examples of the messages the pattern
+//     before it should match, e.g., as written by "sequence analyze", or comments
+//     if there's no pattern before it, or if there's an empty line in between
+//   - lines that start with "# =>", which are the field values expected when the
+//     example before it is parsed, e.g., # => dstuser=jlz msgtime="Jan 15 19:39:26"
+//   - lines that start with "@field", "@define" or "@include", which are directives
+//
+// "@field" registers a custom field for the patterns to use, with the token type
+// of its values, e.g.,
+//
+//   @field %vlan% %integer%
+//
+// "@define" defines a macro, which is replaced by its text wherever it's used in
+// the patterns that follow, including the ones in the other macros, e.g.,
+//
+//   @define @sshd_hdr %msgtime% %apphost% %appname% [ %sessionid% ] :
+//   @sshd_hdr invalid user %dstuser% from %srcipv4%
+//
+// "@include" reads the patterns, and the macros, from another pattern file, e.g.,
+//
+//   @include common/syslog.txt
+//
+// where the path is relative to the directory of the file that includes it. The
+// macros, including the ones defined in the included files, apply to the rest of
+// the file, but not to the other files read with ReadPatterns. A word in a pattern
+// that starts with "@" and is not a macro, e.g., @timestamp, is a literal.
+//
+// The name of the file is used to find the included files, in the PatternErrors and
+// in the PatternDefs. The File and Line of a pattern are where it's written, in
+// the file itself or an included one.
+func ReadPatterns(r io.Reader, file string) ([]PatternDef, error) {
+	pr := &patternReader{macros: make(map[string]string)}
+
+	if err := pr.read(r, file); err != nil {
+		return nil, err
+	}
+
+	return pr.defs, nil
+}
+
+// patternReader keeps the macros and the files being read, to catch include loops,
+// while reading a pattern file and the files it includes.
+type patternReader struct {
+	defs   []PatternDef
+	macros map[string]string
+	files  []string
+}
+
+func (this *patternReader) read(r io.Reader, file string) error {
+	this.files = append(this.files, file)
+	defer func() { this.files = this.files[:len(this.files)-1] }()
+
+	cur := -1 // index of the pattern the examples belong to
+
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case len(line) == 0:
+			cur = -1
+
+		case line[0] == '#':
+			if cur < 0 {
+				break
+			}
+
+			def := &this.defs[cur]
+			text := strings.TrimSpace(line[1:])
+
+			if !strings.HasPrefix(text, "=>") {
+				def.Examples = append(def.Examples, text)
+				break
+			}
+
+			if len(def.Examples) == 0 {
+				return &PatternError{File: file, Line: n, Err: fmt.Errorf("expected field values without an example")}
+			}
+
+			fields, err := parseExpected(text[2:])
+			if err != nil {
+				return &PatternError{File: file, Line: n, Err: err}
+			}
+
+			if def.Expected == nil {
+				def.Expected = make(map[int]map[string]string)
+			}
+
+			def.Expected[len(def.Examples)-1] = fields
+
+		case isDirective(line):
+			if strings.HasPrefix(line, "@include") {
+				if err := this.include(line, file, n); err != nil {
+					return err
+				}
+			} else if err := this.directive(line); err != nil {
+				return &PatternError{File: file, Line: n, Err: err}
+			}
+
+			cur = -1
+
+		default:
+			this.defs = append(this.defs, PatternDef{File: file, Line: n, Pattern: this.expand(line)})
+			cur = len(this.defs) - 1
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return &PatternError{File: file, Err: err}
+	}
+
+	return nil
+}
+
+func isDirective(line string) bool {
+	switch strings.Fields(line)[0] {
+	case "@field", "@define", "@include":
+		return true
+	}
+
+	return false
+}
+
+func (this *patternReader) directive(line string) error {
+	args := strings.Fields(line)
+
+	switch args[0] {
+	case "@field":
+		if len(args) != 3 {
+			return fmt.Errorf("expecting @field %%name%% %%type%%, got %q", line)
+		}
+
+		t := name2TokenType(fieldLabel(args[2]))
+		if t == TokenUnknown {
+			return fmt.Errorf("unknown token type %s", args[2])
+		}
+
+		_, err := RegisterField(args[1], t)
+		return err
+
+	case "@define":
+		if len(args) < 3 {
+			return fmt.Errorf("expecting @define @name pattern, got %q", line)
+		}
+
+		name := "@" + strings.TrimPrefix(args[1], "@")
+		if len(name) == 1 || isDirective(name) || strings.IndexFunc(name[1:], func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+		}) >= 0 {
+			return fmt.Errorf("invalid macro name %s", args[1])
+		}
+
+		text := this.expand(strings.Join(args[2:], " "))
+
+		if old, ok := this.macros[name]; ok && old != text {
+			return fmt.Errorf("macro %s is already defined as %q", name, old)
+		}
+
+		this.macros[name] = text
+		return nil
+	}
+
+	return fmt.Errorf("unknown directive %s", args[0])
+}
+
+func (this *patternReader) include(line, file string, n int) error {
+	args := strings.Fields(line)
+	if len(args) != 2 {
+		return &PatternError{File: file, Line: n, Err: fmt.Errorf("expecting @include file, got %q", line)}
+	}
+
+	path := args[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+
+	for _, f := range this.files {
+		if filepath.Clean(f) == path {
+			return &PatternError{File: file, Line: n, Err: fmt.Errorf("%s includes itself", path)}
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return &PatternError{File: file, Line: n, Err: err}
+	}
+	defer f.Close()
+
+	return this.read(f, path)
+}
+
+// expand replaces the macros in the line with their text. The other words that
+// start with "@" are left as they are, and are matched as literals.
+func (this *patternReader) expand(line string) string {
+	words := strings.Fields(line)
+
+	for i, w := range words {
+		if text, ok := this.macros[w]; ok {
+			words[i] = text
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// parseExpected parses the expected field values, e.g., dstuser=jlz, where the
+// fields can be written with or without the %, and the values can be quoted.
+func parseExpected(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+
+	for s = strings.TrimSpace(s); len(s) > 0; s = strings.TrimSpace(s) {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 || strings.IndexFunc(s[:i], unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("expecting field=value, got %q", s)
+		}
+
+		name := fieldLabel(s[:i])
+		s = s[i+1:]
+
+		if len(s) > 0 && s[0] == '"' {
+			// the closing quote is the first one that's not escaped
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return nil, fmt.Errorf("missing closing quote for the value of %s", name)
+			}
+
+			v, err := strconv.Unquote(s[:j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %s for %s", s[:j+1], name)
+			}
+
+			fields[name], s = v, s[j+1:]
+		} else {
+			j := strings.IndexFunc(s, unicode.IsSpace)
+			if j < 0 {
+				j = len(s)
+			}
+
+			fields[name], s = s[:j], s[j:]
+		}
+	}
+
+	return fields, nil
+}
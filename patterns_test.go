@@ -0,0 +1,106 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPatternsMacros(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patterns")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+		return path
+	}
+
+	write("common/syslog.txt", `
+@define @syslog_hdr %msgtime% %apphost% %appname%
+@define @sshd_hdr   @syslog_hdr [ %sessionid% ] :
+
+@syslog_hdr : started
+`)
+
+	file := write("sshd.txt", `
+@include common/syslog.txt
+
+@sshd_hdr invalid user %dstuser% from %srcipv4%
+# Jan 15 19:39:26 irc sshd[7778]: Invalid user test from 10.1.1.1
+@sshd_hdr received disconnect from %srcipv4% : %integer% : bye bye
+`)
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	defs, err := ReadPatterns(f, file)
+	require.NoError(t, err)
+	require.Equal(t, []PatternDef{
+		{File: filepath.Join(dir, "common/syslog.txt"), Line: 5, Pattern: "%msgtime% %apphost% %appname% : started"},
+		{File: file, Line: 4, Pattern: "%msgtime% %apphost% %appname% [ %sessionid% ] : invalid user %dstuser% from %srcipv4%", Examples: []string{"Jan 15 19:39:26 irc sshd[7778]: Invalid user test from 10.1.1.1"}},
+		{File: file, Line: 6, Pattern: "%msgtime% %apphost% %appname% [ %sessionid% ] : received disconnect from %srcipv4% : %integer% : bye bye"},
+	}, defs)
+
+	parser := NewParser()
+	seq, err := DefaultScanner.Tokenize(defs[1].Pattern, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, err = DefaultScanner.Tokenize(defs[1].Examples[0], nil)
+	require.NoError(t, err)
+	pseq, err := parser.Parse(seq)
+	require.NoError(t, err)
+	require.Equal(t, defs[1].Pattern, pseq.String())
+
+	defs, err = ReadPatterns(strings.NewReader("@define @hdr %msgtime%\n@define @at @hdr @timestamp\n\n@at %string% @host started\n"), "test.txt")
+	require.NoError(t, err)
+	require.Equal(t, []PatternDef{
+		{File: "test.txt", Line: 4, Pattern: "%msgtime% @timestamp %string% @host started"},
+	}, defs)
+
+	seq, err = DefaultScanner.Tokenize(defs[0].Pattern, nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, err = DefaultScanner.Tokenize("Jan 12 06:49:42 @timestamp irc @host started", nil)
+	require.NoError(t, err)
+	pseq, err = parser.Parse(seq)
+	require.NoError(t, err)
+	require.Equal(t, defs[0].Pattern, pseq.String())
+
+	loop := write("loop.txt", "@include loop.txt\n")
+
+	for _, tc := range []struct {
+		data, err string
+	}{
+		{"@define @hdr %msgtime%\n@define hdr %apphost%\n", `test.txt:2: macro @hdr is already defined as "%msgtime%"`},
+		{"@define @a-b %msgtime%\n", "test.txt:1: invalid macro name @a-b"},
+		{"@define @hdr\n", `test.txt:1: expecting @define @name pattern, got "@define @hdr"`},
+		{"@include " + loop + "\n", loop + ":1: " + loop + " includes itself"},
+	} {
+		_, err := ReadPatterns(strings.NewReader(tc.data), "test.txt")
+		require.EqualError(t, err, tc.err, tc.data)
+	}
+}
@@ -17,7 +17,10 @@ package sequence
 import (
 	"fmt"
 	"io"
+	"strings"
 	"unicode"
+
+	"github.com/surge/xparse/etld"
 )
 
 type Scanner interface {
@@ -28,7 +31,10 @@ type Scanner interface {
 // sequence of tokens. It is sequential because it goes through log message
 // sequentially tokentizing each part of the message, without the use of regular
 // expressions. The scanner currently recognizes time stamps, IPv4 addresses, URLs,
-// MAC addresses, integers and floating point numbers.
+// MAC addresses, integers and floating point numbers, including signed, hex,
+// exponent and comma grouped numbers. Literals are further
+// recognized as durations, byte sizes, percentages, host names, email addresses,
+// UUIDs, hex digests (MD5, SHA1 and SHA256) and absolute file paths by their shape.
 type GeneralScanner struct {
 }
 
@@ -227,6 +233,31 @@ func (this *message) scan() (Token, error) {
 			this.state.nxquote = false
 		}
 
+		if t == TokenInteger {
+			// 1,024,000 is scanned as 1, so let's take the rest of the groups,
+			// unless it's a list of ports, e.g., port 80,443
+			if n := groupedLen(this.data[this.state.start:]); n > l && !(listWords[strings.ToLower(this.state.prevToken.Value)] && strings.Count(this.data[this.state.start:this.state.start+n], ",") == 1) {
+				if d := this.data[this.state.start+n:]; len(d) > 1 && d[0] == '.' && digitsLen(d[1:]) > 0 {
+					n += digitsLen(d[1:]) + 1
+				}
+
+				l = n
+				t = numberType(this.data[this.state.start : this.state.start+l])
+			}
+		} else if t == TokenLiteral {
+			// %string{1,5}% in a pattern is scanned as a literal that stops at the {,
+			// so let's take the rest of the tag. ftp://... and www.example.com/a?b=c
+			// are scanned as literals that stop at the first : or =, so let's take
+			// the rest of the URL
+			if n := tagLen(this.data[this.state.start:]); n >= l {
+				l = n
+			} else if n := urlLen(this.data[this.state.start:]); n > l {
+				l, t = n, TokenURL
+			} else {
+				t = literalType(this.data[this.state.start : this.state.start+l])
+			}
+		}
+
 		tok := Token{Field: FieldUnknown, Type: t, Value: this.data[this.state.start : this.state.start+l]}
 		this.state.tokCount++
 		this.state.prevToken = tok
@@ -687,3 +718,348 @@ func isLiteral(r rune) bool {
 func isHex(r rune) bool {
 	return r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r >= '0' && r <= '9'
 }
+
+// literalType returns the type of the literal based on its shape, which is one of
+// TokenInteger, TokenFloat, TokenURL, TokenDuration, TokenBytes, TokenPercent, TokenUUID, TokenHash, TokenPath,
+// TokenEmail or TokenHost, or TokenLiteral if it's none of them.
+func literalType(s string) TokenType {
+	switch {
+	case isUUID(s):
+		return TokenUUID
+
+	case isHash(s):
+		return TokenHash
+	}
+
+	if t := numberType(s); t != TokenLiteral {
+		return t
+	}
+
+	if isURL(s) {
+		return TokenURL
+	}
+
+	if t := numericType(s); t != TokenLiteral {
+		return t
+	}
+
+	switch {
+	case len(s) > 1 && s[0] == '/' && s[1] != '/' && strings.IndexFunc(s, unicode.IsSpace) < 0:
+		return TokenPath
+	}
+
+	if i := strings.IndexByte(s, '@'); i > 0 {
+		if isEmailLocal(s[:i]) && isHost(s[i+1:]) {
+			return TokenEmail
+		}
+
+		return TokenLiteral
+	}
+
+	if isHost(s) && !literalSuffixes[strings.ToLower(s[strings.LastIndexByte(s, '.')+1:])] {
+		return TokenHost
+	}
+
+	return TokenLiteral
+}
+
+// numberType returns TokenInteger or TokenFloat if s is a number that the scanner
+// doesn't recognize on its own, i.e., a signed number, e.g., -42 or +3.5, a hex
+// number, e.g., 0x1F3A, a number with an exponent, e.g., 1e-3, or a number with
+// comma separated groups of thousands, e.g., 1,024,000. Otherwise TokenLiteral is
+// returned.
+func numberType(s string) TokenType {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		for _, r := range s[2:] {
+			if !isHex(r) {
+				return TokenLiteral
+			}
+		}
+
+		return TokenInteger
+	}
+
+	i := digitsLen(s)
+	if i == 0 {
+		return TokenLiteral
+	}
+
+	t := TokenInteger
+
+	if groupedLen(s) > i {
+		i = groupedLen(s)
+	}
+
+	if i < len(s) && s[i] == '.' {
+		n := digitsLen(s[i+1:])
+		if n == 0 {
+			return TokenLiteral
+		}
+
+		i += n + 1
+		t = TokenFloat
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+
+		n := digitsLen(s[i:])
+		if n == 0 {
+			return TokenLiteral
+		}
+
+		i += n
+		t = TokenFloat
+	}
+
+	if i != len(s) {
+		return TokenLiteral
+	}
+
+	return t
+}
+
+// groupedLen returns the length of the number at the beginning of s if it has
+// comma separated groups of thousands, e.g., 1,024 or 1,024,000, or 0 if it
+// doesn't. The first group is 1 to 3 digits, without a leading 0, and the ones
+// after it are 3 digits, so the list 80,443,8080 isn't a grouped number. A single
+// group can still be a list, e.g., of ports in 80,443, which the scanner tells
+// apart by the word before it, see listWords.
+func groupedLen(s string) int {
+	i := digitsLen(s)
+	if i == 0 || i > 3 || s[0] == '0' {
+		return 0
+	}
+
+	groups := 0
+
+	for i < len(s) && s[i] == ',' && digitsLen(s[i+1:]) > 0 {
+		if digitsLen(s[i+1:]) != 3 {
+			return 0
+		}
+
+		i += 4
+		groups++
+	}
+
+	if groups == 0 {
+		return 0
+	}
+
+	return i
+}
+
+func digitsLen(s string) int {
+	for i, r := range s {
+		if r < '0' || r > '9' {
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// tagLen returns the length of the %tag% at the start of s, including the meta,
+// e.g., %string{1,5}% or %srcport:1-1023%, or 0 if s doesn't start with one.
+func tagLen(s string) int {
+	if len(s) < 3 || s[0] != '%' {
+		return 0
+	}
+
+	i := 1
+	for ; i < len(s) && (isLetter(rune(s[i])) || s[i] >= '0' && s[i] <= '9' || s[i] == '.'); i++ {
+	}
+
+	if i == 1 {
+		return 0
+	}
+
+	// invalid metas, e.g., {a}, are taken as well, so Parser.Add can report them
+	if i < len(s) && strings.IndexByte("?+-{", s[i]) >= 0 {
+		for ; i < len(s) && (isLetter(rune(s[i])) || strings.IndexByte("?+-{},0123456789", s[i]) >= 0); i++ {
+		}
+	}
+
+	// the constraint, e.g., :1-1023 or :10.0.0.0/8|192.168.0.0/16
+	if i < len(s) && s[i] == ':' {
+		for ; i < len(s) && s[i] != '%' && !unicode.IsSpace(rune(s[i])); i++ {
+		}
+	}
+
+	if i == len(s) || s[i] != '%' {
+		return 0
+	}
+
+	return i + 1
+}
+
+// urlLen returns the length of the URL at the beginning of s, or 0 if there's
+// none. The URL stops at the first space, quotation mark or angle bracket.
+func urlLen(s string) int {
+	n := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '\'' || r == '<' || r == '>'
+	})
+
+	if n < 0 {
+		n = len(s)
+	}
+
+	if isURL(s[:n]) {
+		return n
+	}
+
+	return 0
+}
+
+// isURL returns true if s is an URL with a scheme, e.g., ftp://example.com, or
+// without one, in which case it must start with a host name, and optionally a
+// port, followed by a path, e.g., www.example.com:8080/a?b=c.
+func isURL(s string) bool {
+	if i := strings.Index(s, "://"); i > 0 {
+		for j, r := range s[:i] {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+				j > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+
+				return false
+			}
+		}
+
+		return len(s) > i+3
+	}
+
+	i := strings.IndexByte(s, '/')
+	if i <= 0 {
+		return false
+	}
+
+	host := s[:i]
+
+	if j := strings.LastIndexByte(host, ':'); j > 0 {
+		if p := host[j+1:]; len(p) == 0 || digitsLen(p) != len(p) {
+			return false
+		}
+
+		host = host[:j]
+	}
+
+	return isHost(host)
+}
+
+// isLiteralShape returns true if the token type is one that literalType returns
+// for a literal, other than TokenLiteral.
+func isLiteralShape(t TokenType) bool {
+	switch t {
+	case TokenHost, TokenEmail, TokenUUID, TokenHash, TokenPath, TokenDuration, TokenBytes, TokenPercent:
+		return true
+	}
+
+	return false
+}
+
+// isUUID returns true if s is in the form of 123e4567-e89b-12d3-a456-426614174000
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+
+		default:
+			if !isHex(r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isHash returns true if s is the hex digest of a MD5, SHA1 or SHA256 hash
+func isHash(s string) bool {
+	if len(s) != 32 && len(s) != 40 && len(s) != 64 {
+		return false
+	}
+
+	for _, r := range s {
+		if !isHex(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// listWords are the words that are followed by lists of numbers, e.g., port
+// 80,443, so a number after them with a single group of thousands is scanned as a
+// list instead.
+var listWords = map[string]bool{
+	"port":  true,
+	"ports": true,
+}
+
+// literalSuffixes are the syslog severities and common file extensions that are
+// also top level domains, so dotted words ending with them, e.g., local4.info or
+// install.sh, are left as literals instead of host names.
+var literalSuffixes = map[string]bool{
+	"emerg": true, "alert": true, "crit": true, "err": true, "error": true,
+	"warn": true, "warning": true, "notice": true, "info": true, "debug": true,
+	"panic": true,
+
+	"log": true, "txt": true, "conf": true, "cfg": true, "ini": true, "json": true,
+	"xml": true, "yaml": true, "yml": true, "csv": true, "sh": true, "py": true,
+	"pl": true, "rb": true, "go": true, "js": true, "java": true, "class": true,
+	"jar": true, "war": true, "c": true, "h": true, "so": true, "exe": true,
+	"dll": true, "html": true, "htm": true, "php": true, "css": true, "md": true,
+	"pdf": true, "doc": true, "docx": true, "xls": true, "xlsx": true, "ppt": true,
+	"pptx": true, "jpg": true, "png": true, "gif": true, "gz": true, "tgz": true,
+	"bz2": true, "xz": true, "zip": true, "tar": true, "rpm": true, "deb": true,
+	"iso": true, "img": true, "bak": true, "tmp": true, "pid": true, "sock": true,
+	"lock": true, "swp": true, "db": true, "sql": true, "dat": true, "out": true,
+}
+
+// isHost returns true if s is a host name that ends with an effective top level
+// domain, e.g., www.example.com
+func isHost(s string) bool {
+	if strings.IndexByte(s, '.') <= 0 {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+
+	return etld.Match(s) > 0
+}
+
+func isEmailLocal(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '.' || r == '_' || r == '+' || r == '-') {
+
+			return false
+		}
+	}
+
+	return len(s) > 0
+}
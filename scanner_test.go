@@ -26,7 +26,7 @@ var (
 	}{
 		{
 			"jan 12 06:49:41 irc sshd[7034]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=218-161-81-238.hinet-ip.hinet.net  user=root",
-			"%time%[%integer%]:(:):;==%integer%=%integer%====",
+			"%time%[%integer%]:(:):;==%integer%=%integer%===%host%=",
 		},
 		{
 			"jan 12 06:49:42 irc sshd[7034]: failed password for root from 218.161.81.238 port 4228 ssh2",
@@ -34,7 +34,7 @@ var (
 		},
 		{
 			"9.26.157.45 - - [16/jan/2003:21:22:59 -0500] \"get /wssamples/ http/1.1\" 200 1576",
-			"%ipv4%--[%time%]\"\"%integer%%integer%",
+			"%ipv4%--[%time%]\"%path%\"%integer%%integer%",
 		},
 		{
 			"209.36.88.3 - - [03/may/2004:01:19:07 +0000] \"get http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectrange&dr=0month&so=relevance&st=nw&ss=afr&sf=article&rc=00&clspage=0&docid=fin0000000r0jl000d00 http/1.0\" 200 27981",
@@ -42,7 +42,7 @@ var (
 		},
 		{
 			"4/5/2012 17:55,172.23.1.101,1101,172.23.0.10,139, generic protocol command decode,3, [1:2100538:17] gpl netbios smb ipc$ unicode share access ,tcp ttl:128 tos:0x0 id:1643 iplen:20 dgmlen:122 df,***ap*** seq: 0xcef93f32  ack: 0xc40c0bb  n: 0xfc9c  tcplen: 20,",
-			"%time%,%ipv4%,%integer%,%ipv4%,%integer%,,%integer%,[%integer%:%integer%:%integer%],:%integer%::%integer%:%integer%:%integer%,::n::%integer%,",
+			"%time%,%ipv4%,%integer%,%ipv4%,%integer%,,%integer%,[%integer%:%integer%:%integer%],:%integer%:%integer%:%integer%:%integer%:%integer%,:%integer%:%integer%n:%integer%:%integer%,",
 		},
 		{
 			"2012-04-05 17:54:47     local4.info     172.23.0.1      %asa-6-302015: built outbound udp connection 1315679 for outside:193.0.14.129/53 (193.0.14.129/53) to inside:172.23.0.10/64048 (10.32.0.1/52130)",
@@ -50,7 +50,7 @@ var (
 		},
 		{
 			"may  2 19:00:02 dlfssrv sendmail[18980]: taa18980: from user daemon: size is 596, class is 0, priority is 30596, and nrcpts=1, message id is <200305021400.taa18980@dlfssrv.in.ibm.com>, relay=daemon@localhost",
-			"%time%[%integer%]:::%integer%,%integer%,%integer%,=%integer%,<>,=",
+			"%time%[%integer%]:::%integer%,%integer%,%integer%,=%integer%,<%email%>,=",
 		},
 		{
 			"jan 12 06:49:56 irc last message repeated 6 times",
@@ -62,7 +62,7 @@ var (
 		},
 		{
 			"2012-04-05 17:51:26     local4.info     172.23.0.1      %asa-6-302016: teardown udp connection 1315632 for inside:172.23.0.2/514 to identity:172.23.0.1/514 duration 0:09:23 bytes 7999",
-			"%time%%ipv4%:%integer%:%ipv4%/%integer%:%ipv4%/%integer%%integer%",
+			"%time%%ipv4%:%integer%:%ipv4%/%integer%:%ipv4%/%integer%%timespan%%integer%",
 		},
 		{
 			"id=firewall time=\"2005-03-18 14:01:43\" fw=topsec priv=4 recorder=kernel type=conn policy=504 proto=tcp rule=deny src=210.82.121.91 sport=4958 dst=61.229.37.85 dport=23124 smac=00:0b:5f:b2:1d:80 dmac=00:04:c1:8b:d8:82",
@@ -74,7 +74,7 @@ var (
 		},
 		{
 			"mar 01 09:45:02.596 pffbisvr smtp[2424]: 121 statistics: duration=181.14 user=<egreetings@vishwak.com> id=zduqd sent=1440 rcvd=356 srcif=d45f49a2-b30 src=209.235.210.30/61663 cldst=192.216.179.206/25 svsrc=172.17.74.195/8423 dstif=fd3c875c-064 dst=172.17.74.52/25 op=\"to 1 recips\" arg=<vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net> result=\"250 m2004030109385301402 message accepted for delivery\" proto=smtp rule=131 (denied access to command 'ehlo vishwakstg1.msn.vishwak.net' from [209.235.210.30])",
-			"%time%[%integer%]:%integer%:=%float%=<>==%integer%=%integer%==%ipv4%/%integer%=%ipv4%/%integer%=%ipv4%/%integer%==%ipv4%/%integer%=\"\"=<>=\"\"==%integer%(''[%ipv4%])",
+			"%time%[%integer%]:%integer%:=%float%=<%email%>==%integer%=%integer%==%ipv4%/%integer%=%ipv4%/%integer%=%ipv4%/%integer%==%ipv4%/%integer%=\"\"=<%email%>=\"\"==%integer%(''[%ipv4%])",
 		},
 	}
 
@@ -116,7 +116,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "rhost"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "218-161-81-238.hinet-ip.hinet.net"},
+				Token{Type: TokenHost, Field: FieldUnknown, Value: "218-161-81-238.hinet-ip.hinet.net"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "user"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "root"},
@@ -186,7 +186,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "\""},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "GET"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "/WSsamples/"},
+				Token{Type: TokenPath, Field: FieldUnknown, Value: "/WSsamples/"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "HTTP/1.1"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "\""},
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "200"},
@@ -252,7 +252,7 @@ var (
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "128"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "TOS"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "0x0"},
+				Token{Type: TokenInteger, Field: FieldUnknown, Value: "0x0"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "ID"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "1643"},
@@ -267,13 +267,13 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "***AP***"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "Seq"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "0xCEF93F32"},
+				Token{Type: TokenInteger, Field: FieldUnknown, Value: "0xCEF93F32"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "Ack"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "0xC40C0BB"},
+				Token{Type: TokenInteger, Field: FieldUnknown, Value: "0xC40C0BB"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "n"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "0xFC9C"},
+				Token{Type: TokenInteger, Field: FieldUnknown, Value: "0xFC9C"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "TcpLen"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ":"},
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "20"},
@@ -305,7 +305,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "/"},
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "514"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "duration"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "0:09:23"},
+				Token{Type: TokenDuration, Field: FieldUnknown, Value: "0:09:23"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "bytes"},
 				Token{Type: TokenInteger, Field: FieldUnknown, Value: "7999"},
 			},
@@ -462,7 +462,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "id"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "is"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "<"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "200305021400.taa18980@dlfssrv.in.ibm.com"},
+				Token{Type: TokenEmail, Field: FieldUnknown, Value: "200305021400.taa18980@dlfssrv.in.ibm.com"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ">"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ","},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "relay"},
@@ -489,7 +489,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "user"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "<"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "egreetings@vishwak.com"},
+				Token{Type: TokenEmail, Field: FieldUnknown, Value: "egreetings@vishwak.com"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ">"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "id"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
@@ -534,7 +534,7 @@ var (
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "arg"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "<"},
-				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net"},
+				Token{Type: TokenEmail, Field: FieldUnknown, Value: "vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: ">"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "result"},
 				Token{Type: TokenLiteral, Field: FieldUnknown, Value: "="},
@@ -569,7 +569,7 @@ var (
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "H", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "(", isKey: false, isValue: false},
-				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "amoricanexpress.com", isKey: false, isValue: false},
+				Token{Field: FieldUnknown, Type: TokenHost, Value: "amoricanexpress.com", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: ")", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "[", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenIPv4, Value: "64.20.195.132", isKey: false, isValue: false},
@@ -579,12 +579,12 @@ var (
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "F", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "<", isKey: false, isValue: false},
-				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "fxC4480@amoricanexpress.com", isKey: false, isValue: false},
+				Token{Field: FieldUnknown, Type: TokenEmail, Value: "fxC4480@amoricanexpress.com", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: ">", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "rejected", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "RCPT", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "<", isKey: false, isValue: false},
-				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "SCRUBBED@SCRUBBED.com", isKey: false, isValue: false},
+				Token{Field: FieldUnknown, Type: TokenEmail, Value: "SCRUBBED@SCRUBBED.com", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: ">", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: ":", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "Sender", isKey: false, isValue: false},
@@ -842,3 +842,98 @@ func BenchmarkGeneralScannerOne(b *testing.B) {
 		DefaultScanner.Tokenize(data, seq)
 	}
 }
+
+func TestGeneralScannerLiteralShapes(t *testing.T) {
+	for _, tc := range []struct {
+		data  string
+		ttype TokenType
+	}{
+		{"mail.example.com", TokenHost},
+		{"218-161-81-238.hinet-ip.hinet.net", TokenHost},
+		{"localhost", TokenLiteral},
+		{"Local4.Info", TokenLiteral},
+		{"kern.warning", TokenLiteral},
+		{"install.sh", TokenLiteral},
+		{"server.log", TokenLiteral},
+		{"root@example.com", TokenEmail},
+		{"daemon@localhost", TokenLiteral},
+		{"123e4567-e89b-12d3-a456-426614174000", TokenUUID},
+		{"123e4567-e89b-12d3-a456-42661417400", TokenLiteral},
+		{"d41d8cd98f00b204e9800998ecf8427e", TokenHash},
+		{"da39a3ee5e6b4b0d3255bfef95601890afd80709", TokenHash},
+		{"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", TokenHash},
+		{"d41d8cd98f00b204e9800998ecf8427", TokenLiteral},
+		{"/var/log/messages", TokenPath},
+		{"/", TokenLiteral},
+		{"postfix/anvil", TokenLiteral},
+		{"0:00:30", TokenDuration},
+		{"5m3s", TokenDuration},
+		{"123ms", TokenDuration},
+		{"0:60:00", TokenLiteral},
+		{"1.5MB", TokenBytes},
+		{"4GiB", TokenBytes},
+		{"87%", TokenPercent},
+		{"1.5x", TokenLiteral},
+		{"-42", TokenInteger},
+		{"+3.5", TokenFloat},
+		{"0x1F3A", TokenInteger},
+		{"0x1G", TokenLiteral},
+		{"1e-3", TokenFloat},
+		{"1E5", TokenFloat},
+		{"1e", TokenLiteral},
+		{"1,024,000", TokenInteger},
+		{"1,024", TokenInteger},
+		{"10,000,000.5", TokenFloat},
+		{"1.2", TokenFloat},
+		{"1.2.3.4", TokenIPv4},
+		{"ftp://ftp.example.com/pub/file.txt", TokenURL},
+		{"ldap://ldap.example.com/dc=example,dc=com?cn", TokenURL},
+		{"www.example.com/a?b=c", TokenURL},
+		{"www.example.com:8080/a", TokenURL},
+		{"www.example.com", TokenHost},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.data, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(seq), tc.data)
+		require.Equal(t, tc.ttype, seq[0].Type, tc.data)
+	}
+}
+
+func TestGeneralScannerGroupedNumbers(t *testing.T) {
+	seq, err := DefaultScanner.Tokenize("sent 1,024,000 of 10,000,000 on ports 80,443,8080", nil)
+	require.NoError(t, err)
+	require.Equal(t, "%integer%%integer%%integer%,%integer%,%integer%", seq.Signature())
+	require.Equal(t, "1,024,000", seq[1].Value)
+	require.Equal(t, "10,000,000", seq[3].Value)
+
+	// a single group is a number, unless it's a list of ports
+	for _, data := range []string{"sent 1,024 bytes", "sent 80,443 bytes"} {
+		seq, err := DefaultScanner.Tokenize(data, nil)
+		require.NoError(t, err)
+		require.Equal(t, "%integer%", seq.Signature(), data)
+		require.Len(t, seq, 3, data)
+	}
+
+	seq, err = DefaultScanner.Tokenize("sent 1,024 bytes", nil)
+	require.NoError(t, err)
+	require.Equal(t, "1,024", seq[1].Value)
+
+	n, err := seq[1].Int()
+	require.NoError(t, err)
+	require.Equal(t, int64(1024), n)
+
+	for _, data := range []string{"ports 80,443 open", "Port 80,443 open", "sent 0,443 bytes", "sent 1,0243 bytes"} {
+		seq, err := DefaultScanner.Tokenize(data, nil)
+		require.NoError(t, err)
+		require.Len(t, seq, 5, data)
+	}
+
+	seq, err = DefaultScanner.Tokenize("ports 80,443 open", nil)
+	require.NoError(t, err)
+	require.Equal(t, "80", seq[1].Value)
+	require.Equal(t, "443", seq[3].Value)
+
+	port, err := seq[1].Int()
+	require.NoError(t, err)
+	require.Equal(t, int64(80), port)
+}
@@ -0,0 +1,358 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Schema translates a parsed sequence into a document that follows an output
+// schema, such as the Elastic Common Schema (ECS) or the Open Cybersecurity Schema
+// Framework (OCSF). Each field, e.g., srcipv4, and each piece of metadata about the
+// message, e.g., pattern_id, is mapped to a dotted path in the document, e.g.,
+// source.ip.
+type Schema struct {
+	// Name of the schema
+	Name string
+
+	// Fields maps the field names, without the %'s, and the metadata names to the
+	// dotted paths in the document.
+	Fields map[string]string
+
+	// Unmapped is the path under which the fields that are not in Fields are
+	// placed. If it's empty, these fields are dropped.
+	Unmapped string
+
+	// Static are the values that are added to every document, keyed by path.
+	Static map[string]interface{}
+}
+
+// Schemas are the output schemas available, keyed by name. By default, "ecs" and
+// "ocsf" are available. They can be changed, and new ones added, with LoadSchemas.
+var Schemas = make(map[string]*Schema)
+
+type schemaConfig struct {
+	Unmapped *string
+	Fields   map[string]string
+	Static   map[string]interface{}
+}
+
+func init() {
+	if err := LoadSchemas(defaultSchemaConfig); err != nil {
+		panic(err)
+	}
+}
+
+// LoadSchemas reads schema definitions in TOML format, and adds them to Schemas.
+// Each schema is a table with the name of the schema, e.g.,
+//
+//   [ecs]
+//   unmapped = "labels"
+//
+//   [ecs.fields]
+//   srcipv4 = "source.ip"
+//   srcuser = "source.user.name"
+//   object  = ""
+//
+//   [ecs.static]
+//   "event.kind" = "event"
+//
+// If the schema already exists, the entries are merged into it, so only the ones
+// that are different need to be listed. A field mapped to "" is removed from the
+// mapping, and is then placed under the unmapped path.
+func LoadSchemas(data string) error {
+	var cfg map[string]schemaConfig
+
+	if _, err := toml.Decode(data, &cfg); err != nil {
+		return err
+	}
+
+	for name, sc := range cfg {
+		s, ok := Schemas[name]
+		if !ok {
+			s = &Schema{
+				Name:   name,
+				Fields: make(map[string]string),
+				Static: make(map[string]interface{}),
+			}
+			Schemas[name] = s
+		}
+
+		if sc.Unmapped != nil {
+			s.Unmapped = *sc.Unmapped
+		}
+
+		for f, path := range sc.Fields {
+			if path == "" {
+				delete(s.Fields, f)
+			} else {
+				s.Fields[f] = path
+			}
+		}
+
+		for path, v := range sc.Static {
+			s.Static[path] = v
+		}
+	}
+
+	return nil
+}
+
+// Document returns the document for the parsed sequence, with the metadata
+// supplied, e.g., "message", "pattern" and "pattern_id". Only the tokens that have
+// a field type are included. Numeric tokens are converted to numbers, with
+// durations in seconds, byte sizes in bytes and percentages as ratios. Timestamps
+// are converted to RFC 3339, see Token.Time, and the ones that can't be are placed
+// under the unmapped path instead. If the same path is used more than once, the
+// values are collected in a list.
+func (this *Schema) Document(seq Sequence, meta map[string]string) map[string]interface{} {
+	doc := make(map[string]interface{})
+
+	for path, v := range this.Static {
+		this.set(doc, path, v)
+	}
+
+	for name, v := range meta {
+		if v != "" {
+			this.setField(doc, name, v)
+		}
+	}
+
+	for _, tok := range seq {
+		if tok.Field == FieldUnknown {
+			continue
+		}
+
+		var (
+			name             = strings.Trim(tok.Field.String(), "%")
+			v    interface{} = tok.Value
+		)
+
+		switch tok.Type {
+		case TokenInteger, TokenBytes:
+			if i, err := tok.Int(); err == nil {
+				v = i
+			}
+
+		case TokenFloat, TokenDuration, TokenPercent:
+			if f, err := tok.Float(); err == nil {
+				v = f
+			}
+
+		case TokenTime:
+			t, err := tok.Time()
+			if err != nil {
+				if this.Unmapped != "" {
+					this.add(doc, this.Unmapped+"."+name, v)
+				}
+
+				continue
+			}
+
+			v = t.Format(time.RFC3339Nano)
+		}
+
+		this.setField(doc, name, v)
+	}
+
+	return doc
+}
+
+func (this *Schema) setField(doc map[string]interface{}, name string, v interface{}) {
+	if path, ok := this.Fields[name]; ok {
+		this.add(doc, path, v)
+	} else if this.Unmapped != "" {
+		this.add(doc, this.Unmapped+"."+name, v)
+	}
+}
+
+// add sets the value at the path, or appends it to the values already there
+func (this *Schema) add(doc map[string]interface{}, path string, v interface{}) {
+	parent, key := this.parent(doc, path)
+	if parent == nil {
+		return
+	}
+
+	switch old := parent[key].(type) {
+	case nil:
+		parent[key] = v
+
+	case []interface{}:
+		parent[key] = append(old, v)
+
+	case map[string]interface{}:
+		// don't replace an object with a value
+
+	default:
+		parent[key] = []interface{}{old, v}
+	}
+}
+
+// set sets the value at the path, replacing any value that's already there
+func (this *Schema) set(doc map[string]interface{}, path string, v interface{}) {
+	if parent, key := this.parent(doc, path); parent != nil {
+		parent[key] = v
+	}
+}
+
+// parent returns the object that holds the last element of the path, creating
+// the objects along the way, and the last element. If one of the elements along
+// the way is already a value, nil is returned.
+func (this *Schema) parent(doc map[string]interface{}, path string) (map[string]interface{}, string) {
+	parts := strings.Split(path, ".")
+	cur := doc
+
+	for _, p := range parts[:len(parts)-1] {
+		switch next := cur[p].(type) {
+		case nil:
+			m := make(map[string]interface{})
+			cur[p] = m
+			cur = m
+
+		case map[string]interface{}:
+			cur = next
+
+		default:
+			return nil, ""
+		}
+	}
+
+	return cur, parts[len(parts)-1]
+}
+
+var defaultSchemaConfig = `
+[ecs]
+unmapped = "labels"
+
+[ecs.static]
+"ecs.version" 	= "8.11.0"
+"event.kind" 	= "event"
+
+[ecs.fields]
+message 	= "event.original"
+msgid 		= "event.id"
+msgtime 	= "@timestamp"
+severity 	= "log.level"
+priority 	= "log.syslog.priority"
+apphost 	= "host.hostname"
+appipv4 	= "host.ip"
+appvendor 	= "observer.vendor"
+appname 	= "process.name"
+srcdomain 	= "source.user.domain"
+srczone 	= "observer.ingress.zone"
+srchost 	= "source.domain"
+srcipv4 	= "source.ip"
+srcipv4nat 	= "source.nat.ip"
+srcipv6 	= "source.ip"
+srcport 	= "source.port"
+srcportnat 	= "source.nat.port"
+srcmac 		= "source.mac"
+srcuser 	= "user.name"
+srcuid 		= "user.id"
+srcgroup 	= "user.group.name"
+srcgid 		= "user.group.id"
+srcemail 	= "email.from.address"
+dstdomain 	= "destination.user.domain"
+dstzone 	= "observer.egress.zone"
+dsthost 	= "destination.domain"
+dstipv4 	= "destination.ip"
+dstipv4nat 	= "destination.nat.ip"
+dstipv6 	= "destination.ip"
+dstport 	= "destination.port"
+dstportnat 	= "destination.nat.port"
+dstmac 		= "destination.mac"
+dstuser 	= "destination.user.name"
+dstuid 		= "destination.user.id"
+dstgroup 	= "destination.user.group.name"
+dstgid 		= "destination.user.group.id"
+dstemail 	= "email.to.address"
+protocol 	= "network.transport"
+iniface 	= "observer.ingress.interface.name"
+outiface 	= "observer.egress.interface.name"
+policyid 	= "rule.id"
+sessionid 	= "process.pid"
+action 		= "event.action"
+command 	= "process.command_line"
+reason 		= "event.reason"
+bytessent 	= "source.bytes"
+bytesrecv 	= "destination.bytes"
+pktssent 	= "source.packets"
+pktsrecv 	= "destination.packets"
+urlscheme 	= "url.scheme"
+urlhost 	= "url.domain"
+urlport 	= "url.port"
+urlpath 	= "url.path"
+urlquery 	= "url.query"
+urlfragment = "url.fragment"
+
+[ocsf]
+unmapped = "unmapped"
+
+[ocsf.static]
+"metadata.version" 	= "1.1.0"
+
+[ocsf.fields]
+message 	= "raw_data"
+msgid 		= "metadata.uid"
+msgtime 	= "time_dt"
+severity 	= "severity"
+apphost 	= "device.hostname"
+appipv4 	= "device.ip"
+appvendor 	= "metadata.product.vendor_name"
+appname 	= "metadata.product.name"
+srcdomain 	= "src_endpoint.domain"
+srczone 	= "src_endpoint.zone"
+srchost 	= "src_endpoint.hostname"
+srcipv4 	= "src_endpoint.ip"
+srcipv6 	= "src_endpoint.ip"
+srcport 	= "src_endpoint.port"
+srcmac 		= "src_endpoint.mac"
+srcuser 	= "actor.user.name"
+srcuid 		= "actor.user.uid"
+srcemail 	= "actor.user.email_addr"
+dstdomain 	= "dst_endpoint.domain"
+dstzone 	= "dst_endpoint.zone"
+dsthost 	= "dst_endpoint.hostname"
+dstipv4 	= "dst_endpoint.ip"
+dstipv6 	= "dst_endpoint.ip"
+dstport 	= "dst_endpoint.port"
+dstmac 		= "dst_endpoint.mac"
+dstuser 	= "user.name"
+dstuid 		= "user.uid"
+dstemail 	= "user.email_addr"
+protocol 	= "connection_info.protocol_name"
+iniface 	= "src_endpoint.interface_name"
+outiface 	= "dst_endpoint.interface_name"
+policyid 	= "policy.uid"
+sessionid 	= "session.uid"
+action 		= "activity_name"
+command 	= "actor.process.cmd_line"
+status 		= "status"
+reason 		= "status_detail"
+bytesrecv 	= "traffic.bytes_in"
+bytessent 	= "traffic.bytes_out"
+pktsrecv 	= "traffic.packets_in"
+pktssent 	= "traffic.packets_out"
+urlscheme 	= "http_request.url.scheme"
+urlhost 	= "http_request.url.hostname"
+urlport 	= "http_request.url.port"
+urlpath 	= "http_request.url.path"
+urlquery 	= "http_request.url.query_string"
+# the url object has no attribute for the fragment
+urlfragment = "unmapped.http_request.url.fragment"
+`
@@ -0,0 +1,93 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var schemaTestSeq = Sequence{
+	{Field: FieldMsgTime, Type: TokenTime, Value: "Jan 15 19:39:26"},
+	{Field: FieldAppName, Type: TokenString, Value: "sshd"},
+	{Field: FieldUnknown, Type: TokenLiteral, Value: "for"},
+	{Field: FieldDstUser, Type: TokenString, Value: "jlz"},
+	{Field: FieldSrcIPv4, Type: TokenIPv4, Value: "108.61.8.124"},
+	{Field: FieldSrcPort, Type: TokenInteger, Value: "57630"},
+	{Field: FieldMethod, Type: TokenString, Value: "password"},
+}
+
+func TestSchemaDocument(t *testing.T) {
+	doc := Schemas["ecs"].Document(schemaTestSeq, map[string]string{"message": "raw", "pattern_id": "abc"})
+
+	require.Regexp(t, `^\d{4}-01-15T19:39:26Z$`, doc["@timestamp"])
+	require.Equal(t, map[string]interface{}{"name": "sshd"}, doc["process"])
+	require.Equal(t, map[string]interface{}{"ip": "108.61.8.124", "port": int64(57630)}, doc["source"])
+	require.Equal(t, map[string]interface{}{"user": map[string]interface{}{"name": "jlz"}}, doc["destination"])
+	require.Equal(t, map[string]interface{}{"method": "password", "pattern_id": "abc"}, doc["labels"])
+	require.Equal(t, map[string]interface{}{"kind": "event", "original": "raw"}, doc["event"])
+
+	doc = Schemas["ocsf"].Document(schemaTestSeq, nil)
+
+	require.Regexp(t, `^\d{4}-01-15T19:39:26Z$`, doc["time_dt"])
+	require.Nil(t, doc["class_uid"])
+	require.Equal(t, map[string]interface{}{"name": "jlz"}, doc["user"])
+	require.Equal(t, map[string]interface{}{"ip": "108.61.8.124", "port": int64(57630)}, doc["src_endpoint"])
+}
+
+func TestSchemaDocumentTime(t *testing.T) {
+	seq := Sequence{{Field: FieldMsgTime, Type: TokenTime, Value: "sometime"}}
+
+	doc := Schemas["ecs"].Document(seq, nil)
+	require.Nil(t, doc["@timestamp"])
+	require.Equal(t, map[string]interface{}{"msgtime": "sometime"}, doc["labels"])
+
+	seq[0].Value = "2012-04-05 17:51:26"
+
+	doc = Schemas["ocsf"].Document(seq, nil)
+	require.Equal(t, "2012-04-05T17:51:26Z", doc["time_dt"])
+}
+
+func TestSchemaLoad(t *testing.T) {
+	err := LoadSchemas(`
+[test]
+unmapped = "extra"
+
+[test.fields]
+srcipv4 = "src.addr"
+srcport = "src.addr"
+dstuser = ""
+
+[test.static]
+"meta.kind" = "log"
+`)
+	require.NoError(t, err)
+	defer delete(Schemas, "test")
+
+	doc := Schemas["test"].Document(schemaTestSeq, nil)
+
+	require.Equal(t, map[string]interface{}{"addr": []interface{}{"108.61.8.124", int64(57630)}}, doc["src"])
+	require.Equal(t, map[string]interface{}{"kind": "log"}, doc["meta"])
+	require.Equal(t, "jlz", doc["extra"].(map[string]interface{})["dstuser"])
+
+	// Overriding a single field of an existing schema keeps the rest
+	require.NoError(t, LoadSchemas("[test.fields]\nsrcport = \"src.port\"\n"))
+
+	doc = Schemas["test"].Document(schemaTestSeq, nil)
+
+	require.Equal(t, map[string]interface{}{"addr": "108.61.8.124", "port": int64(57630)}, doc["src"])
+	require.Equal(t, "extra", Schemas["test"].Unmapped)
+}
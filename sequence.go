@@ -24,7 +24,10 @@ import (
 //go:generate go fmt tokens.go
 
 var (
-	ErrNoMatch = errors.New("sequence: no pattern matched for this message")
+	ErrNoMatch   = errors.New("sequence: no pattern matched for this message")
+	ErrNoPattern = errors.New("sequence: no pattern found with this id")
+
+	ErrInvalidValue = errors.New("sequence: invalid value for the token type")
 )
 
 // Sequence represents a list of tokens returned from the scanner, analyzer or parser.
@@ -36,9 +39,9 @@ func (this Sequence) String() string {
 
 	for _, token := range this {
 		if token.Field != FieldUnknown {
-			p += token.Field.String() + " "
+			p += withMeta(token.Field.String(), token.Meta) + " "
 		} else if token.Type != TokenUnknown && token.Type != TokenLiteral {
-			p += token.Type.String() + " "
+			p += withMeta(token.Type.String(), token.Meta) + " "
 		} else if token.Type == TokenLiteral {
 			p += token.Value + " "
 		}
@@ -47,6 +50,15 @@ func (this Sequence) String() string {
 	return strings.TrimSpace(p)
 }
 
+// withMeta adds the meta, e.g., + or {1,5}, to the %tag%
+func withMeta(tag, meta string) string {
+	if meta == "" {
+		return tag
+	}
+
+	return tag[:len(tag)-1] + meta + "%"
+}
+
 // Signature returns a single line string that represents a common pattern for this
 // types of messages, basically stripping any strings or literals from the message.
 func (this Sequence) Signature() string {
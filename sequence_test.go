@@ -219,7 +219,7 @@ var (
 				Token{Field: FieldDstPort, Type: TokenInteger, Value: "25", isKey: false, isValue: true},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "duration", isKey: true, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Field: FieldUnknown, Type: TokenInteger, Value: "27", isKey: false, isValue: true},
+				Token{Field: FieldDuration, Type: TokenDuration, Value: "27", isKey: false, isValue: true},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "inpkt", isKey: true, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Field: FieldUnknown, Type: TokenInteger, Value: "37", isKey: false, isValue: true},
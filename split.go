@@ -0,0 +1,96 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strings"
+)
+
+// SplitRule splits the values captured by a field at a separator into two parts,
+// each with its own field, e.g., CORP\alice captured by %srcuser% into CORP for
+// %srcdomain% and alice for %srcuser%.
+type SplitRule struct {
+	// Field is the field that captured the value
+	Field FieldType
+
+	// Sep is the separator. Values that have more than one separator, e.g., the
+	// IPv6 address fe80::1 for ":", are not split.
+	Sep string
+
+	// Before and After are the fields of the parts before and after the
+	// separator. A part must be of the token type of its field, e.g., an IPv4
+	// address for %srcipv4%, unless the field is a %string% one.
+	Before, After FieldType
+}
+
+// SplitRules are the rules Decompose applies to the parsed sequence. For each
+// token, the first rule for its field that applies is used, so the more specific
+// rules for a field should come first.
+var SplitRules = []SplitRule{
+	{Field: FieldSrcUser, Sep: `\`, Before: FieldSrcDomain, After: FieldSrcUser},
+	{Field: FieldSrcUser, Sep: "@", Before: FieldSrcUser, After: FieldSrcHost},
+	{Field: FieldDstUser, Sep: `\`, Before: FieldDstDomain, After: FieldDstUser},
+	{Field: FieldDstUser, Sep: "@", Before: FieldDstUser, After: FieldDstHost},
+	{Field: FieldSrcHost, Sep: ":", Before: FieldSrcIPv4, After: FieldSrcPort},
+	{Field: FieldSrcHost, Sep: ":", Before: FieldSrcHost, After: FieldSrcPort},
+	{Field: FieldDstHost, Sep: ":", Before: FieldDstIPv4, After: FieldDstPort},
+	{Field: FieldDstHost, Sep: ":", Before: FieldDstHost, After: FieldDstPort},
+}
+
+// splitToken splits the token with the first of the SplitRules that applies
+func splitToken(tok Token) ([2]Token, bool) {
+	if tok.Field == FieldUnknown {
+		return [2]Token{}, false
+	}
+
+	for _, rule := range SplitRules {
+		if rule.Field != tok.Field {
+			continue
+		}
+
+		if strings.Count(tok.Value, rule.Sep) != 1 {
+			continue
+		}
+
+		i := strings.Index(tok.Value, rule.Sep)
+		if i == 0 || i+len(rule.Sep) == len(tok.Value) {
+			continue
+		}
+
+		before, ok := splitPart(rule.Before, tok.Value[:i])
+		if !ok {
+			continue
+		}
+
+		after, ok := splitPart(rule.After, tok.Value[i+len(rule.Sep):])
+		if !ok {
+			continue
+		}
+
+		return [2]Token{before, after}, true
+	}
+
+	return [2]Token{}, false
+}
+
+func splitPart(f FieldType, v string) (Token, bool) {
+	t := f.TokenType()
+
+	if t != TokenString && !looseType(t, cellType(v)) {
+		return Token{}, false
+	}
+
+	return Token{Field: f, Type: t, Value: v}, true
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecomposeSplit(t *testing.T) {
+	parser := NewParser()
+
+	seq, err := DefaultScanner.Tokenize("logon success for %srcuser% at %integer%", nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	for _, tc := range []struct {
+		msg  string
+		user string
+		part Sequence
+	}{
+		{
+			`logon success for CORP\alice at 4624`,
+			"alice",
+			Sequence{{Field: FieldSrcDomain, Type: TokenString, Value: "corp"}},
+		},
+		{
+			"logon success for alice@corp.example at 4624",
+			"alice",
+			Sequence{{Field: FieldSrcHost, Type: TokenString, Value: "corp.example"}},
+		},
+		{
+			"logon success for alice at 4624",
+			"alice",
+			Sequence{},
+		},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		pseq, err := parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		l := len(pseq)
+		pseq = Decompose(pseq)
+		require.Equal(t, tc.user, pseq[3].Value, tc.msg)
+		require.Equal(t, FieldSrcUser, pseq[3].Field, tc.msg)
+		require.Equal(t, tc.part, pseq[l:], tc.msg)
+	}
+
+	for _, tc := range []struct {
+		value string
+		parts [2]Token
+		ok    bool
+	}{
+		{
+			"10.1.2.3:443",
+			[2]Token{
+				{Field: FieldSrcIPv4, Type: TokenIPv4, Value: "10.1.2.3"},
+				{Field: FieldSrcPort, Type: TokenInteger, Value: "443"},
+			},
+			true,
+		},
+		{
+			"www.example.com:8080",
+			[2]Token{
+				{Field: FieldSrcHost, Type: TokenString, Value: "www.example.com"},
+				{Field: FieldSrcPort, Type: TokenInteger, Value: "8080"},
+			},
+			true,
+		},
+		{"fe80::1", [2]Token{}, false},
+		{"www.example.com:http", [2]Token{}, false},
+	} {
+		parts, ok := splitToken(Token{Field: FieldSrcHost, Type: TokenString, Value: tc.value})
+		require.Equal(t, tc.ok, ok, tc.value)
+		require.Equal(t, tc.parts, parts, tc.value)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"sort"
+	"sync"
+)
+
+// ParseStats keeps count of the messages parsed, the hits of each pattern, and
+// the messages that no pattern matched, grouped by their signatures. It's safe
+// for concurrent use.
+type ParseStats struct {
+	mu        sync.Mutex
+	messages  int
+	hits      map[string]int
+	unmatched map[string]*SignatureCount
+}
+
+// ParseReport is the summary of the ParseStats.
+type ParseReport struct {
+	Messages int `json:"messages"`
+	Matched  int `json:"matched"`
+
+	// Coverage is the percentage of the messages that are matched
+	Coverage float64 `json:"coverage"`
+
+	// Patterns are the hits of each pattern, including the ones without any, with
+	// the most hits first
+	Patterns []PatternHits `json:"patterns"`
+
+	// Unmatched are the messages no pattern matched, grouped by their signatures,
+	// with the most common first
+	Unmatched []SignatureCount `json:"unmatched"`
+}
+
+// PatternHits is the number of messages a pattern matched. Source is where the
+// pattern is defined, if it's known.
+type PatternHits struct {
+	ID      string `json:"id"`
+	Pattern string `json:"pattern"`
+	Source  string `json:"source,omitempty"`
+	Hits    int    `json:"hits"`
+}
+
+// SignatureCount is the number of unmatched messages with the signature, and the
+// first one of them as the example.
+type SignatureCount struct {
+	Signature string `json:"signature"`
+	Count     int    `json:"count"`
+	Example   string `json:"example"`
+}
+
+func NewParseStats() *ParseStats {
+	return &ParseStats{
+		hits:      make(map[string]int),
+		unmatched: make(map[string]*SignatureCount),
+	}
+}
+
+// Matched counts a message matched by the pattern with the ID.
+func (this *ParseStats) Matched(id string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.messages++
+	this.hits[id]++
+}
+
+// Unmatched counts a message that no pattern matched, with the sequence it's
+// tokenized into.
+func (this *ParseStats) Unmatched(seq Sequence, msg string) {
+	sig := seq.Signature()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.messages++
+
+	if sc, ok := this.unmatched[sig]; ok {
+		sc.Count++
+	} else {
+		this.unmatched[sig] = &SignatureCount{Signature: sig, Count: 1, Example: msg}
+	}
+}
+
+// Report returns the summary of the stats, with the hits of all the patterns in
+// the parsers, so the ones that matched no messages are included as well.
+func (this *ParseStats) Report(parsers ...*Parser) ParseReport {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	report := ParseReport{Messages: this.messages}
+
+	seen := make(map[string]bool)
+
+	for _, parser := range parsers {
+		for _, id := range parser.Patterns() {
+			if seen[id] {
+				continue
+			}
+
+			seen[id] = true
+
+			var pat string
+			if seq, err := parser.Pattern(id); err == nil {
+				pat = seq.String()
+			}
+
+			report.Patterns = append(report.Patterns, PatternHits{ID: id, Pattern: pat, Hits: this.hits[id]})
+			report.Matched += this.hits[id]
+		}
+	}
+
+	// patterns that have since been removed from the parsers
+	for id, hits := range this.hits {
+		if !seen[id] {
+			report.Patterns = append(report.Patterns, PatternHits{ID: id, Hits: hits})
+			report.Matched += hits
+		}
+	}
+
+	sort.Slice(report.Patterns, func(i, j int) bool {
+		if report.Patterns[i].Hits != report.Patterns[j].Hits {
+			return report.Patterns[i].Hits > report.Patterns[j].Hits
+		}
+
+		return report.Patterns[i].ID < report.Patterns[j].ID
+	})
+
+	for _, sc := range this.unmatched {
+		report.Unmatched = append(report.Unmatched, *sc)
+	}
+
+	sort.Slice(report.Unmatched, func(i, j int) bool {
+		if report.Unmatched[i].Count != report.Unmatched[j].Count {
+			return report.Unmatched[i].Count > report.Unmatched[j].Count
+		}
+
+		return report.Unmatched[i].Signature < report.Unmatched[j].Signature
+	})
+
+	if report.Messages > 0 {
+		report.Coverage = float64(report.Matched) * 100 / float64(report.Messages)
+	}
+
+	return report
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStats(t *testing.T) {
+	parser := NewParser()
+
+	var ids []string
+
+	for _, pat := range []string{
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : accepted password for %srcuser% from %srcipv4% port %srcport% ssh2",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%",
+		"%msgtime% %apphost% %appname% [ %sessionid% ] : server listening on %srcipv4% port %srcport%",
+	} {
+		seq, err := DefaultScanner.Tokenize(pat, nil)
+		require.NoError(t, err)
+		require.NoError(t, parser.Add(seq))
+		ids = append(ids, PatternID(seq))
+	}
+
+	stats := NewParseStats()
+
+	for _, msg := range []string{
+		"Jan 15 19:39:26 irc sshd[7778]: Accepted password for jlz from 108.61.8.124 port 57630 ssh2",
+		"Jan 15 19:39:27 irc sshd[7779]: Connection closed by 108.61.8.125",
+		"Jan 15 19:39:28 irc sshd[7780]: Accepted password for root from 108.61.8.126 port 22 ssh2",
+		"Jan 15 19:39:29 irc sshd[7781]: Received disconnect from 108.61.8.127: 11: Bye Bye",
+		"Jan 15 19:39:30 irc sshd[7782]: Received disconnect from 108.61.8.128: 11: Bye Bye",
+		"Jan 15 19:39:31 irc sshd[7783]: Invalid user admin",
+	} {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+
+		if _, id, err := parser.ParsePattern(seq); err != nil {
+			stats.Unmatched(seq, msg)
+		} else {
+			stats.Matched(id)
+		}
+	}
+
+	report := stats.Report(parser)
+	require.Equal(t, 6, report.Messages)
+	require.Equal(t, 3, report.Matched)
+	require.Equal(t, 50.0, report.Coverage)
+
+	require.Len(t, report.Patterns, 3)
+	require.Equal(t, ids[0], report.Patterns[0].ID)
+	require.Equal(t, 2, report.Patterns[0].Hits)
+	require.Equal(t, ids[1], report.Patterns[1].ID)
+	require.Equal(t, 1, report.Patterns[1].Hits)
+	require.Equal(t, ids[2], report.Patterns[2].ID)
+	require.Equal(t, 0, report.Patterns[2].Hits)
+	require.Contains(t, report.Patterns[2].Pattern, "server listening on")
+
+	require.Len(t, report.Unmatched, 2)
+	require.Equal(t, 2, report.Unmatched[0].Count)
+	require.Contains(t, report.Unmatched[0].Example, "sshd[7781]: Received disconnect")
+	require.Equal(t, 1, report.Unmatched[1].Count)
+	require.Contains(t, report.Unmatched[1].Example, "Invalid user admin")
+}
+
+func TestParseStatsRemoved(t *testing.T) {
+	stats := NewParseStats()
+
+	ids := []string{"e", "a", "d", "b", "c"}
+	for _, id := range ids {
+		stats.Matched(id)
+	}
+	stats.Matched("d")
+
+	// the patterns are no longer in any parser, and the ties are sorted by ID
+	for i := 0; i < 10; i++ {
+		var got []string
+		for _, ph := range stats.Report(NewParser()).Patterns {
+			got = append(got, ph.ID)
+		}
+
+		require.Equal(t, []string{"d", "a", "b", "c", "e"}, got)
+	}
+}
@@ -14,7 +14,7 @@
 
 // This file is automatically generated by 'gentokens.go' using 'go generate',
 // and MUST not be modified. The 'go generate' line is in sequence.go.
-// This file is generated on 2015-02-09 19:03:22.288379152 -0800 PST.
+// This file is generated on 2026-10-19 08:11:50.557599868 +0000 UTC.
 
 package sequence
 
@@ -29,6 +29,7 @@ type Token struct {
 	Type  TokenType // Type is the type of token the Value represents.
 	Field FieldType // Field determines which field the Value should be.
 	Value string    // Value is the extracted string from the log message.
+	Meta  string    // Meta is the repetition of the token in a pattern, e.g., ? or {1,5}.
 
 	isValue bool // Is this token a key in k=v pair
 	isKey   bool // Is this token a value in k=v pair
@@ -47,8 +48,10 @@ type (
 )
 
 const (
-	metaMore = '+'
-	metaRest = '-'
+	metaOptional = '?'
+	metaMore     = '+'
+	metaRest     = '-'
+	metaRepeat   = '{'
 )
 
 const (
@@ -61,76 +64,90 @@ const (
 )
 
 const (
-	TokenUnknown   TokenType = iota // Unknown token
-	TokenLiteral                    // Token is a fixed literal
-	TokenTime                       // Token is a timestamp, in the format listed in TimeFormats
-	TokenIPv4                       // Token is an IPv4 address, in the form of a.b.c.d
-	TokenIPv6                       // Token is an IPv6 address, not currently supported
-	TokenInteger                    // Token is an integer number
-	TokenFloat                      // Token is a floating point number
-	TokenURL                        // Token is an URL, in the form of http://... or https://...
-	TokenMac                        // Token is a mac address
-	TokenString                     // Token is a string that reprensents multiple possible values
-	token__END__                    // All field types must be inserted before this one
-	token__host__                   // Token is a host name
-	token__email__                  // Token is an email address
+	TokenUnknown  TokenType = iota // Unknown token
+	TokenLiteral                   // Token is a fixed literal
+	TokenTime                      // Token is a timestamp, in the format listed in TimeFormats
+	TokenIPv4                      // Token is an IPv4 address, in the form of a.b.c.d
+	TokenIPv6                      // Token is an IPv6 address, not currently supported
+	TokenInteger                   // Token is an integer number
+	TokenFloat                     // Token is a floating point number
+	TokenURL                       // Token is an URL, e.g., http://..., ftp://... or www.example.com/a?b=c
+	TokenMac                       // Token is a mac address
+	TokenString                    // Token is a string that reprensents multiple possible values
+	TokenHost                      // Token is a host name, e.g., www.example.com
+	TokenEmail                     // Token is an email address, e.g., root@example.com
+	TokenUUID                      // Token is an UUID, e.g., 123e4567-e89b-12d3-a456-426614174000
+	TokenHash                      // Token is a MD5, SHA1 or SHA256 hex digest
+	TokenPath                      // Token is an absolute file path, e.g., /var/log/messages
+	TokenDuration                  // Token is a duration, e.g., 0:00:30, 5m3s or 123ms
+	TokenBytes                     // Token is a byte size, e.g., 1.5MB or 4GiB
+	TokenPercent                   // Token is a percentage, e.g., 87%
+	token__END__                   // All field types must be inserted before this one
 )
 
 const (
-	FieldUnknown    FieldType = iota // Unknown field type
-	FieldMsgId                       // The message identifier
-	FieldMsgTime                     // The timestamp that’s part of the log message
-	FieldSeverity                    // The severity of the event, e.g., Emergency, …
-	FieldPriority                    // The pirority of the event
-	FieldAppHost                     // The hostname of the host where the log message is generated
-	FieldAppIPv4                     // The IP address of the host where the application that generated the log message is running on.
-	FieldAppVendor                   // The type of application that generated the log message, e.g., Cisco, ISS
-	FieldAppName                     // The name of the application that generated the log message, e.g., asa, snort, sshd
-	FieldSrcDomain                   // The domain name of the initiator of the event, usually a Windows domain
-	FieldSrcZone                     // The originating zone
-	FieldSrcHost                     // The hostname of the originator of the event or connection.
-	FieldSrcIPv4                     // The IPv4 address of the originator of the event or connection.
-	FieldSrcIPv4NAT                  // The natted (network address translation) IP of the originator of the event or connection.
-	FieldSrcIPv6                     // The IPv6 address of the originator of the event or connection.
-	FieldSrcPort                     // The port number of the originating connection.
-	FieldSrcPortNAT                  // The natted port number of the originating connection.
-	FieldSrcMac                      // The mac address of the host that originated the connection.
-	FieldSrcUser                     // The user that originated the session.
-	FieldSrcUid                      // The user id that originated the session.
-	FieldSrcGroup                    // The group that originated the session.
-	FieldSrcGid                      // The group id that originated the session.
-	FieldSrcEmail                    // The originating email address
-	FieldDstDomain                   // The domain name of the destination of the event, usually a Windows domain
-	FieldDstZone                     // The destination zone
-	FieldDstHost                     // The hostname of the destination of the event or connection.
-	FieldDstIPv4                     // The IPv4 address of the destination of the event or connection.
-	FieldDstIPv4NAT                  // The natted (network address translation) IP of the destination of the event or connection.
-	FieldDstIPv6                     // The IPv6 address of the destination of the event or connection.
-	FieldDstPort                     // The destination port number of the connection.
-	FieldDstPortNAT                  // The natted destination port number of the connection.
-	FieldDstMac                      // The mac address of the destination host.
-	FieldDstUser                     // The user at the destination.
-	FieldDstUid                      // The user id that originated the session.
-	FieldDstGroup                    // The group that originated the session.
-	FieldDstGid                      // The group id that originated the session.
-	FieldDstEmail                    // The destination email address
-	FieldProtocol                    // The protocol, such as TCP, UDP, ICMP, of the connection
-	FieldInIface                     // The incoming interface
-	FieldOutIface                    // The outgoing interface
-	FieldPolicyID                    // The policy ID
-	FieldSessionID                   // The session or process ID
-	FieldObject                      // The object affected.
-	FieldAction                      // The action taken
-	FieldCommand                     // The command executed
-	FieldMethod                      // The method in which the action was taken, for example, public key or password for ssh
-	FieldStatus                      // The status of the action taken
-	FieldReason                      // The reason for the action taken or the status returned
-	FieldBytesRecv                   // The number of bytes received
-	FieldBytesSent                   // The number of bytes sent
-	FieldPktsRecv                    // The number of packets received
-	FieldPktsSent                    // The number of packets sent
-	FieldDuration                    // The duration of the session
-	field__END__                     // All field types must be inserted before this one
+	FieldUnknown     FieldType = iota // Unknown field type
+	FieldMsgId                        // The message identifier
+	FieldMsgTime                      // The timestamp that’s part of the log message
+	FieldSeverity                     // The severity of the event, e.g., Emergency, …
+	FieldPriority                     // The pirority of the event
+	FieldAppHost                      // The hostname of the host where the log message is generated
+	FieldAppIPv4                      // The IP address of the host where the application that generated the log message is running on.
+	FieldAppVendor                    // The type of application that generated the log message, e.g., Cisco, ISS
+	FieldAppName                      // The name of the application that generated the log message, e.g., asa, snort, sshd
+	FieldSrcDomain                    // The domain name of the initiator of the event, usually a Windows domain
+	FieldSrcZone                      // The originating zone
+	FieldSrcHost                      // The hostname of the originator of the event or connection.
+	FieldSrcIPv4                      // The IPv4 address of the originator of the event or connection.
+	FieldSrcIPv4NAT                   // The natted (network address translation) IP of the originator of the event or connection.
+	FieldSrcIPv6                      // The IPv6 address of the originator of the event or connection.
+	FieldSrcPort                      // The port number of the originating connection.
+	FieldSrcPortNAT                   // The natted port number of the originating connection.
+	FieldSrcMac                       // The mac address of the host that originated the connection.
+	FieldSrcUser                      // The user that originated the session.
+	FieldSrcUid                       // The user id that originated the session.
+	FieldSrcGroup                     // The group that originated the session.
+	FieldSrcGid                       // The group id that originated the session.
+	FieldSrcEmail                     // The originating email address
+	FieldDstDomain                    // The domain name of the destination of the event, usually a Windows domain
+	FieldDstZone                      // The destination zone
+	FieldDstHost                      // The hostname of the destination of the event or connection.
+	FieldDstIPv4                      // The IPv4 address of the destination of the event or connection.
+	FieldDstIPv4NAT                   // The natted (network address translation) IP of the destination of the event or connection.
+	FieldDstIPv6                      // The IPv6 address of the destination of the event or connection.
+	FieldDstPort                      // The destination port number of the connection.
+	FieldDstPortNAT                   // The natted destination port number of the connection.
+	FieldDstMac                       // The mac address of the destination host.
+	FieldDstUser                      // The user at the destination.
+	FieldDstUid                       // The user id that originated the session.
+	FieldDstGroup                     // The group that originated the session.
+	FieldDstGid                       // The group id that originated the session.
+	FieldDstEmail                     // The destination email address
+	FieldProtocol                     // The protocol, such as TCP, UDP, ICMP, of the connection
+	FieldInIface                      // The incoming interface
+	FieldOutIface                     // The outgoing interface
+	FieldPolicyID                     // The policy ID
+	FieldSessionID                    // The session or process ID
+	FieldObject                       // The object affected.
+	FieldAction                       // The action taken
+	FieldCommand                      // The command executed
+	FieldMethod                       // The method in which the action was taken, for example, public key or password for ssh
+	FieldStatus                       // The status of the action taken
+	FieldReason                       // The reason for the action taken or the status returned
+	FieldBytesRecv                    // The number of bytes received
+	FieldBytesSent                    // The number of bytes sent
+	FieldPktsRecv                     // The number of packets received
+	FieldPktsSent                     // The number of packets sent
+	FieldDuration                     // The duration of the session
+	FieldURLScheme                    // The scheme of the URL, e.g., http or ftp
+	FieldURLHost                      // The host name or IP address of the URL
+	FieldURLPort                      // The port of the URL
+	FieldURLPath                      // The path of the URL
+	FieldURLQuery                     // The query string of the URL, without the ?
+	FieldURLFragment                  // The fragment of the URL, without the #
+	FieldURLParam                     // The name of a query parameter of the URL
+	FieldURLParamVal                  // The value of the query parameter before it
+	field__END__                      // All field types must be inserted before this one
 )
 
 var (
@@ -147,9 +164,15 @@ var (
 		{"%url%"},
 		{"%mac%"},
 		{"%string%"},
+		{"%host%"},
+		{"%email%"},
+		{"%uuid%"},
+		{"%hash%"},
+		{"%path%"},
+		{"%timespan%"},
+		{"%bytes%"},
+		{"%percent%"},
 		{"token__END__"},
-		{"token__host__"},
-		{"token__email__"},
 	}
 
 	fields = []struct {
@@ -204,11 +227,19 @@ var (
 		{"%method%", TokenString},
 		{"%status%", TokenString},
 		{"%reason%", TokenString},
-		{"%bytesrecv%", TokenInteger},
-		{"%bytessent%", TokenInteger},
+		{"%bytesrecv%", TokenBytes},
+		{"%bytessent%", TokenBytes},
 		{"%pktsrecv%", TokenInteger},
 		{"%pktssent%", TokenInteger},
-		{"%duration%", TokenString},
+		{"%duration%", TokenDuration},
+		{"%urlscheme%", TokenString},
+		{"%urlhost%", TokenString},
+		{"%urlport%", TokenInteger},
+		{"%urlpath%", TokenString},
+		{"%urlquery%", TokenString},
+		{"%urlfragment%", TokenString},
+		{"%urlparam%", TokenString},
+		{"%urlparamval%", TokenString},
 		{"field__END__", TokenString},
 	}
 )
@@ -218,7 +249,8 @@ func (this TokenType) String() string {
 }
 
 func (this FieldType) String() string {
-	return fields[this].label
+	label, _ := fieldDef(this)
+	return label
 }
 
 func name2TokenType(s string) TokenType {
@@ -243,12 +275,24 @@ func name2TokenType(s string) TokenType {
 		return TokenMac
 	case "%string%":
 		return TokenString
+	case "%host%":
+		return TokenHost
+	case "%email%":
+		return TokenEmail
+	case "%uuid%":
+		return TokenUUID
+	case "%hash%":
+		return TokenHash
+	case "%path%":
+		return TokenPath
+	case "%timespan%":
+		return TokenDuration
+	case "%bytes%":
+		return TokenBytes
+	case "%percent%":
+		return TokenPercent
 	case "token__END__":
 		return token__END__
-	case "token__host__":
-		return token__host__
-	case "token__email__":
-		return token__email__
 	}
 
 	return TokenUnknown
@@ -362,13 +406,30 @@ func name2FieldType(s string) FieldType {
 		return FieldPktsSent
 	case "%duration%":
 		return FieldDuration
+	case "%urlscheme%":
+		return FieldURLScheme
+	case "%urlhost%":
+		return FieldURLHost
+	case "%urlport%":
+		return FieldURLPort
+	case "%urlpath%":
+		return FieldURLPath
+	case "%urlquery%":
+		return FieldURLQuery
+	case "%urlfragment%":
+		return FieldURLFragment
+	case "%urlparam%":
+		return FieldURLParam
+	case "%urlparamval%":
+		return FieldURLParamVal
 	case "field__END__":
 		return field__END__
 	}
 
-	return FieldUnknown
+	return registeredField(s)
 }
 
 func (this FieldType) TokenType() TokenType {
-	return fields[this].ttype
+	_, ttype := fieldDef(this)
+	return ttype
 }
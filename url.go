@@ -0,0 +1,117 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Decompose breaks the composite values in the parsed sequence into their parts.
+//
+// The values captured by the fields in SplitRules are split, e.g., CORP\alice
+// captured by %srcuser% becomes alice, and CORP is added for %srcdomain%, and
+// 10.1.2.3:443 captured by %srchost% becomes 10.1.2.3 for %srcipv4%, and 443 is
+// added for %srcport%. The part with the field that captured the value, or the
+// part before the separator if neither has it, stays in place.
+//
+// Each URL is broken into its scheme, host, port, path, query and fragment, which
+// are added with the %urlscheme%, %urlhost%, %urlport%, %urlpath%, %urlquery% and
+// %urlfragment% fields. Parts that are not in the URL are skipped. The name and
+// the unescaped value of each query parameter follow, with the %urlparam% and
+// %urlparamval% fields, in the order they are in the query. The URL tokens are the
+// ones with the %url% type, and the %string% ones, e.g., %object%, whose values
+// are URLs.
+//
+// The parts are added to the end of the sequence. They are not part of the
+// pattern, so the pattern, e.g., from Sequence.String, should be taken before the
+// sequence is decomposed.
+func Decompose(seq Sequence) Sequence {
+	for i, l := 0, len(seq); i < l; i++ {
+		if parts, ok := splitToken(seq[i]); ok {
+			// the part with the field that captured the value stays in place
+			if parts[1].Field == seq[i].Field {
+				parts[0], parts[1] = parts[1], parts[0]
+			}
+
+			seq[i] = parts[0]
+			seq = append(seq, parts[1])
+		}
+
+		tok := seq[i]
+
+		if tok.Type != TokenURL && (tok.Type != TokenString || !isURL(tok.Value)) {
+			continue
+		}
+
+		seq = append(seq, urlParts(tok.Value)...)
+	}
+
+	return seq
+}
+
+// urlParts returns the scheme, host, port, path, query and fragment of the URL,
+// followed by the name and value of each query parameter
+func urlParts(v string) Sequence {
+	if !strings.Contains(v, "://") {
+		v = "//" + v
+	}
+
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil
+	}
+
+	var parts Sequence
+
+	for _, part := range []struct {
+		field FieldType
+		value string
+	}{
+		{FieldURLScheme, strings.ToLower(u.Scheme)},
+		{FieldURLHost, u.Hostname()},
+		{FieldURLPort, u.Port()},
+		{FieldURLPath, u.Path},
+		{FieldURLQuery, u.RawQuery},
+		{FieldURLFragment, u.Fragment},
+	} {
+		if part.value != "" {
+			parts = append(parts, Token{Field: part.field, Type: part.field.TokenType(), Value: part.value})
+		}
+	}
+
+	for _, param := range strings.FieldsFunc(u.RawQuery, func(r rune) bool { return r == '&' || r == ';' }) {
+		name, value := param, ""
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name, value = param[:i], param[i+1:]
+		}
+
+		if s, err := url.QueryUnescape(name); err == nil {
+			name = s
+		}
+
+		if s, err := url.QueryUnescape(value); err == nil {
+			value = s
+		}
+
+		if name != "" {
+			parts = append(parts,
+				Token{Field: FieldURLParam, Type: TokenString, Value: name},
+				Token{Field: FieldURLParamVal, Type: TokenString, Value: value})
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompose(t *testing.T) {
+	parser := NewParser()
+
+	seq, err := DefaultScanner.Tokenize("proxy %srcipv4% get %url% %integer%", nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	for _, tc := range []struct {
+		msg   string
+		parts Sequence
+	}{
+		{
+			"proxy 10.1.1.1 get HTTP://www.example.com:8080/a/b.html?x=1&y=2#top 200",
+			Sequence{
+				{Field: FieldURLScheme, Type: TokenString, Value: "http"},
+				{Field: FieldURLHost, Type: TokenString, Value: "www.example.com"},
+				{Field: FieldURLPort, Type: TokenInteger, Value: "8080"},
+				{Field: FieldURLPath, Type: TokenString, Value: "/a/b.html"},
+				{Field: FieldURLQuery, Type: TokenString, Value: "x=1&y=2"},
+				{Field: FieldURLFragment, Type: TokenString, Value: "top"},
+				{Field: FieldURLParam, Type: TokenString, Value: "x"},
+				{Field: FieldURLParamVal, Type: TokenString, Value: "1"},
+				{Field: FieldURLParam, Type: TokenString, Value: "y"},
+				{Field: FieldURLParamVal, Type: TokenString, Value: "2"},
+			},
+		},
+		{
+			"proxy 10.1.1.1 get ftp://ftp.example.com/pub/file.txt 226",
+			Sequence{
+				{Field: FieldURLScheme, Type: TokenString, Value: "ftp"},
+				{Field: FieldURLHost, Type: TokenString, Value: "ftp.example.com"},
+				{Field: FieldURLPath, Type: TokenString, Value: "/pub/file.txt"},
+			},
+		},
+		{
+			"proxy 10.1.1.1 get www.example.com/a?b=c%20d&flag 404",
+			Sequence{
+				{Field: FieldURLHost, Type: TokenString, Value: "www.example.com"},
+				{Field: FieldURLPath, Type: TokenString, Value: "/a"},
+				{Field: FieldURLQuery, Type: TokenString, Value: "b=c%20d&flag"},
+				{Field: FieldURLParam, Type: TokenString, Value: "b"},
+				{Field: FieldURLParamVal, Type: TokenString, Value: "c d"},
+				{Field: FieldURLParam, Type: TokenString, Value: "flag"},
+				{Field: FieldURLParamVal, Type: TokenString, Value: ""},
+			},
+		},
+	} {
+		seq, err := DefaultScanner.Tokenize(tc.msg, nil)
+		require.NoError(t, err)
+		pseq, err := parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, "proxy %srcipv4% get %url% %integer%", pseq.String())
+
+		l := len(pseq)
+		pseq = Decompose(pseq)
+		require.Equal(t, tc.parts, pseq[l:], tc.msg)
+	}
+}
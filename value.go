@@ -0,0 +1,266 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are the multipliers of the byte size units, in lower case
+var byteUnits = map[string]float64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// Int returns the value of an integer token, e.g., -42, 0x1F3A or 1,024, or the
+// number of bytes of a byte size token, e.g., 2048 for 2KiB.
+func (this Token) Int() (int64, error) {
+	switch this.Type {
+	case TokenInteger:
+		if i, ok := parseInt(this.Value); ok {
+			return i, nil
+		}
+
+	case TokenBytes:
+		if b, ok := parseBytes(this.Value); ok {
+			return int64(math.Round(b)), nil
+		}
+	}
+
+	return 0, ErrInvalidValue
+}
+
+// Float returns the numeric value of the token, normalized by its type. Integers
+// and floating point numbers are returned as is, durations are in seconds, byte
+// sizes are in bytes, and percentages are ratios, e.g., 0.87 for 87%.
+func (this Token) Float() (float64, error) {
+	var (
+		f  float64
+		ok bool
+	)
+
+	switch this.Type {
+	case TokenInteger:
+		var i int64
+		if i, ok = parseInt(this.Value); ok {
+			f = float64(i)
+		}
+
+	case TokenFloat:
+		f, ok = parseNumber(strings.Replace(this.Value, ",", "", -1))
+
+	case TokenDuration:
+		var d time.Duration
+		if d, ok = parseDuration(this.Value); ok {
+			f = d.Seconds()
+		}
+
+	case TokenBytes:
+		f, ok = parseBytes(this.Value)
+
+	case TokenPercent:
+		f, ok = parsePercent(this.Value)
+	}
+
+	if !ok {
+		return 0, ErrInvalidValue
+	}
+
+	return f, nil
+}
+
+// Duration returns the value of a duration token, e.g., 0:00:30, 5m3s or 123ms.
+// Integers and floating point numbers are taken as seconds.
+func (this Token) Duration() (time.Duration, error) {
+	switch this.Type {
+	case TokenDuration, TokenInteger, TokenFloat:
+		if d, ok := parseDuration(this.Value); ok {
+			return d, nil
+		}
+	}
+
+	return 0, ErrInvalidValue
+}
+
+// Time returns the value of a timestamp token, in one of the TimeFormats. The
+// timestamps without a year are taken to be in the current year, or the previous
+// one if they would be more than a day in the future, e.g., the messages from
+// December read in January. The ones without a time zone are taken as UTC.
+func (this Token) Time() (time.Time, error) {
+	if this.Type != TokenTime {
+		return time.Time{}, ErrInvalidValue
+	}
+
+	for _, f := range TimeFormats {
+		t, err := time.Parse(f, this.Value)
+		if err != nil {
+			continue
+		}
+
+		if t.Year() == 0 {
+			now := time.Now().UTC()
+
+			if t = t.AddDate(now.Year(), 0, 0); t.After(now.AddDate(0, 0, 1)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+
+		return t, nil
+	}
+
+	return time.Time{}, ErrInvalidValue
+}
+
+// numericType returns the type of the literal if it's a duration, a byte size or
+// a percentage, or TokenLiteral if it's none of them.
+func numericType(s string) TokenType {
+	if len(s) == 0 || s[0] < '0' || s[0] > '9' {
+		return TokenLiteral
+	}
+
+	if _, ok := parseNumber(s); ok {
+		return TokenLiteral
+	}
+
+	if _, ok := parseDuration(s); ok {
+		return TokenDuration
+	}
+
+	if _, ok := parseBytes(s); ok {
+		return TokenBytes
+	}
+
+	if _, ok := parsePercent(s); ok {
+		return TokenPercent
+	}
+
+	return TokenLiteral
+}
+
+// parseInt parses integers, with optional signs, hex prefixes and comma separated
+// groups of thousands. Leading zeros don't make it octal, e.g., 0755 is 755.
+func parseInt(s string) (int64, bool) {
+	var neg bool
+
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	base := 10
+
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		base = 16
+		s = s[2:]
+	} else {
+		s = strings.Replace(s, ",", "", -1)
+	}
+
+	u, err := strconv.ParseUint(s, base, 64)
+	if err != nil || u > math.MaxInt64 {
+		return 0, false
+	}
+
+	if neg {
+		return -int64(u), true
+	}
+
+	return int64(u), true
+}
+
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// parseDuration parses durations in the form of h:mm:ss, with optional fractions
+// of a second, e.g., 0:00:30 or 1:02:03.500, the ones time.ParseDuration takes,
+// e.g., 5m3s or 123ms, and numbers, which are taken as seconds.
+func parseDuration(s string) (time.Duration, bool) {
+	if f, ok := parseNumber(s); ok {
+		return time.Duration(f * float64(time.Second)), true
+	}
+
+	if parts := strings.Split(s, ":"); len(parts) == 3 {
+		if len(parts[1]) != 2 || len(parts[2]) < 2 || (len(parts[2]) > 2 && parts[2][2] != '.') {
+			return 0, false
+		}
+
+		h, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return 0, false
+		}
+
+		m, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil || m > 59 {
+			return 0, false
+		}
+
+		sec, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || sec >= 60 || parts[2][0] < '0' || parts[2][0] > '9' {
+			return 0, false
+		}
+
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), true
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && s[0] >= '0' && s[0] <= '9' {
+		return d, true
+	}
+
+	return 0, false
+}
+
+// parseBytes parses byte sizes, e.g., 512B, 1.5MB or 4GiB, into the number of
+// bytes. KB, MB, etc, are powers of 1000, while KiB, MiB, etc, are powers of 1024.
+// Numbers without units are taken as bytes.
+func parseBytes(s string) (float64, bool) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+
+	if i < 0 {
+		return parseNumber(s)
+	} else if i == 0 {
+		return 0, false
+	}
+
+	u, ok := byteUnits[strings.ToLower(s[i:])]
+	if !ok {
+		return 0, false
+	}
+
+	f, ok := parseNumber(s[:i])
+	return f * u, ok
+}
+
+// parsePercent parses percentages, e.g., 87% or 0.5%, into ratios. Numbers
+// without the % are taken as percentages as well.
+func parsePercent(s string) (float64, bool) {
+	f, ok := parseNumber(strings.TrimSuffix(s, "%"))
+	return f / 100, ok
+}
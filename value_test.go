@@ -0,0 +1,117 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenValues(t *testing.T) {
+	for _, tc := range []struct {
+		tok Token
+		f   float64
+	}{
+		{Token{Type: TokenInteger, Value: "42"}, 42},
+		{Token{Type: TokenFloat, Value: "1.5"}, 1.5},
+		{Token{Type: TokenDuration, Value: "0:00:30"}, 30},
+		{Token{Type: TokenDuration, Value: "1:02:03.5"}, 3723.5},
+		{Token{Type: TokenDuration, Value: "5m3s"}, 303},
+		{Token{Type: TokenDuration, Value: "123ms"}, 0.123},
+		{Token{Type: TokenDuration, Value: "27"}, 27},
+		{Token{Type: TokenBytes, Value: "1.5MB"}, 1500000},
+		{Token{Type: TokenBytes, Value: "2KiB"}, 2048},
+		{Token{Type: TokenBytes, Value: "7999"}, 7999},
+		{Token{Type: TokenPercent, Value: "87%"}, 0.87},
+	} {
+		f, err := tc.tok.Float()
+		require.NoError(t, err, tc.tok.Value)
+		require.InDelta(t, tc.f, f, 1e-9, tc.tok.Value)
+	}
+
+	i, err := Token{Type: TokenBytes, Value: "1.5MB"}.Int()
+	require.NoError(t, err)
+	require.Equal(t, int64(1500000), i)
+
+	for v, n := range map[string]int64{"-42": -42, "+7": 7, "0x1F3A": 0x1f3a, "1,024": 1024, "0755": 755} {
+		i, err := Token{Type: TokenInteger, Value: v}.Int()
+		require.NoError(t, err, v)
+		require.Equal(t, n, i, v)
+	}
+
+	f, err := Token{Type: TokenFloat, Value: "1e-3"}.Float()
+	require.NoError(t, err)
+	require.Equal(t, 0.001, f)
+
+	d, err := Token{Type: TokenDuration, Value: "0:09:23"}.Duration()
+	require.NoError(t, err)
+	require.Equal(t, 9*time.Minute+23*time.Second, d)
+
+	_, err = Token{Type: TokenString, Value: "42"}.Float()
+	require.Equal(t, ErrInvalidValue, err)
+
+	_, err = Token{Type: TokenBytes, Value: "1.5XB"}.Int()
+	require.Equal(t, ErrInvalidValue, err)
+}
+
+func TestTokenTime(t *testing.T) {
+	for v, ts := range map[string]string{
+		"2012-04-05 17:51:26":         "2012-04-05T17:51:26Z",
+		"16/jan/2003:21:22:59 -0500":  "2003-01-16T21:22:59-05:00",
+		"2005-03-18T14:01:43.5+08:00": "2005-03-18T14:01:43.5+08:00",
+	} {
+		tm, err := Token{Type: TokenTime, Value: v}.Time()
+		require.NoError(t, err, v)
+		require.Equal(t, ts, tm.Format(time.RFC3339Nano), v)
+	}
+
+	// the timestamps without a year are in the last year
+	now := time.Now().UTC()
+
+	for _, v := range []string{"Jan 15 19:39:26", "dec 31 23:59:59"} {
+		tm, err := Token{Type: TokenTime, Value: v}.Time()
+		require.NoError(t, err, v)
+		require.True(t, tm.Year() == now.Year() || tm.Year() == now.Year()-1, v)
+		require.False(t, tm.After(now.AddDate(0, 0, 1)), v)
+	}
+
+	_, err := Token{Type: TokenTime, Value: "yesterday"}.Time()
+	require.Equal(t, ErrInvalidValue, err)
+
+	_, err = Token{Type: TokenString, Value: "2012-04-05 17:51:26"}.Time()
+	require.Equal(t, ErrInvalidValue, err)
+}
+
+func TestParserLooseTypes(t *testing.T) {
+	parser := NewParser()
+
+	seq, err := DefaultScanner.Tokenize("teardown duration %duration% bytes %bytessent% cpu %percent%", nil)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	for _, msg := range []string{
+		"teardown duration 0:09:23 bytes 1.5MB cpu 87%",
+		"teardown duration 27 bytes 7999 cpu 5.5%",
+	} {
+		seq, err := DefaultScanner.Tokenize(msg, nil)
+		require.NoError(t, err)
+		pseq, err := parser.Parse(seq)
+		require.NoError(t, err, msg)
+		require.Equal(t, FieldDuration, pseq[2].Field)
+		require.Equal(t, TokenBytes, pseq[4].Type)
+	}
+}